@@ -0,0 +1,399 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	nmapscan "github.com/helar52-xl/batch_scan_ip_base_nmap/nmap_scan"
+)
+
+// 一次批量扫描的参数，与命令行参数对应
+type batchOptions struct {
+	SourceExcel   string
+	Sheet         string
+	ColumnAliases string
+	FilePath      string
+	IPList        string
+	NmapArgs      string
+	ExcelOutput   string
+	Concurrency   int
+	Resume        bool
+	ResolveDomain bool
+	DNSServer     string
+	OutputFormats string
+	OutputBase    string
+	DBPath        string
+	PolicyFile    string
+	HTMLOutput    string
+	CVEDB         string
+	// 为空时自动选择，见 selectScanner
+	Scanner nmapscan.Scanner
+	// 分阶段扫描：先用 DiscoverArgs 快速发现开放端口，再对这些端口执行 NmapArgs
+	TwoPhase     bool
+	DiscoverArgs string
+	// 第一阶段使用的扫描器，为空时与 Scanner 相同
+	DiscoverScanner nmapscan.Scanner
+	// 每个nmap进程扫描的主机数，小于等于1时每个主机单独扫描
+	BatchSize int
+	// 授权范围文件，范围外的行只写入输出，不扫描
+	ScopeFile string
+	// 输出扫描计划(命令行、跳过的行和耗时估算)，不扫描，PlanOutput 不为空时另存为CSV
+	Plan       bool
+	PlanOutput string
+}
+
+// 读取源文件、扫描并写入各种输出。ctx取消时停止扫描并保存已有结果
+func runBatch(ctx context.Context, opts batchOptions) error {
+	nmapArgs, warnings, err := nmapscan.ParseArgs(opts.NmapArgs)
+	if err != nil {
+		return err
+	}
+	for _, w := range warnings {
+		logf("警告: %s\n", w)
+	}
+	scanOpts := nmapscan.Options{Args: nmapArgs}
+
+	var discoverOpts nmapscan.Options
+	if opts.TwoPhase {
+		args, warnings, err := nmapscan.ParseArgs(opts.DiscoverArgs)
+		if err != nil {
+			return fmt.Errorf("端口发现参数: %v", err)
+		}
+		for _, w := range warnings {
+			logf("警告: 端口发现参数: %s\n", w)
+		}
+		discoverOpts.Args = discoveryArgs(args, nmapArgs)
+	}
+
+	// 风险规则
+	var rules *policy
+	if opts.PolicyFile != "" {
+		if rules, err = loadPolicy(opts.PolicyFile); err != nil {
+			return err
+		}
+	}
+
+	// 本地漏洞库
+	var cves *cveDB
+	if opts.CVEDB != "" {
+		if _, err := os.Stat(opts.CVEDB); err != nil {
+			return fmt.Errorf("漏洞库不存在，请先使用 import-nvd 导入: %v", err)
+		}
+		if cves, err = openCVEDB(opts.CVEDB); err != nil {
+			return err
+		}
+		defer cves.Close()
+	}
+
+	var sourceInfos []ExcelInfo
+
+	switch {
+	case opts.SourceExcel != "":
+		// 从Excel文件读取信息
+		columns, err := nmapscan.ParseColumnAliases(opts.ColumnAliases, nmapscan.InputColumns(nmapscan.ColIP))
+		if err != nil {
+			return err
+		}
+		sourceInfos, err = readExcel(opts.SourceExcel, opts.Sheet, columns)
+		if err != nil {
+			return fmt.Errorf("读取Excel文件失败: %v", err)
+		}
+	case opts.FilePath != "":
+		// 从文件读取IP，每行可附带名称和备注
+		sourceInfos, err = readIPFile(opts.FilePath)
+		if err != nil {
+			return err
+		}
+	case opts.IPList != "":
+		// 从命令行参数获取IP
+		sourceInfos = parseIPList(opts.IPList)
+	default:
+		return errors.New("请提供扫描内容")
+	}
+
+	for i := range sourceInfos {
+		sourceInfos[i].SourceRow = i + 1
+		sourceInfos[i].SourceTarget = sourceInfos[i].IP
+		if sourceInfos[i].SourceTarget == "" {
+			sourceInfos[i].SourceTarget = sourceInfos[i].Domain
+		}
+	}
+
+	// 没有IP的行通过网站地址解析出IP
+	if opts.ResolveDomain {
+		sourceInfos = resolveInfos(sourceInfos, newDomainResolver(opts.DNSServer, 10*time.Second))
+	}
+
+	// 网段、范围等目标展开为单个主机，每个主机单独一行
+	sourceInfos = expandInfos(sourceInfos)
+
+	// 扫描前检查每个目标是否在授权范围内，主机名和解析出的IP也要检查
+	if opts.ScopeFile != "" {
+		s, err := loadScope(opts.ScopeFile, newDomainResolver(opts.DNSServer, 10*time.Second))
+		if err != nil {
+			return err
+		}
+		for i := range sourceInfos {
+			if sourceInfos[i].TargetError != "" {
+				continue
+			}
+			reason, addr := s.check(sourceInfos[i])
+			sourceInfos[i].OutOfScope = reason
+			if addr != "" {
+				// 主机名目标改为扫描检查过的地址
+				logf("%s 按授权范围检查时解析为 %s，扫描该地址\n", sourceInfos[i].IP, addr)
+				sourceInfos[i].IPSource = "DNS解析: " + sourceInfos[i].IP
+				sourceInfos[i].IP = addr
+			}
+		}
+	}
+
+	// 地址都确定后再找重复的目标
+	markDuplicates(sourceInfos)
+
+	scanner := opts.Scanner
+	if scanner == nil {
+		// 定时任务等未指定时自动选择，auto 不会返回错误
+		scanner, _ = selectScanner("auto", "", &nmapscan.ConnectScanner{Retries: 1})
+		if _, ok := scanner.(*nmapscan.ConnectScanner); ok {
+			logf("警告: 本机没有nmap，本次任务改用内置扫描，结果中没有服务版本和操作系统；建议在参数中设置 --host-timeout 限制每个主机的耗时\n")
+		}
+	}
+	if opts.TwoPhase {
+		discover := opts.DiscoverScanner
+		if discover == nil {
+			discover = scanner
+		}
+		if _, ok := scanner.(*nmapscan.ConnectScanner); ok {
+			// 内置扫描得不到服务信息，只执行端口发现
+			logf("警告: 没有nmap，分阶段扫描只执行端口发现\n")
+			scanner, scanOpts = discover, discoverOpts
+		} else {
+			scanner = &twoPhaseScanner{discover: discover, discoverOpts: discoverOpts, detect: scanner}
+		}
+	}
+	if _, ok := scanner.(nmapscan.BatchScanner); opts.BatchSize > 1 && !ok {
+		logf("警告: 当前扫描方式(内置扫描或分阶段扫描)不支持 -batch，每个主机单独扫描\n")
+	}
+
+	// 预览模式不扫描，也不打开状态文件和输出文件
+	if opts.Plan {
+		p := newScanPlan(sourceInfos, scanner, scanOpts, opts.Concurrency, opts.BatchSize)
+		p.print()
+		if opts.PlanOutput != "" {
+			if err := p.writeCSV(opts.PlanOutput); err != nil {
+				return err
+			}
+			logf("扫描计划已保存到: %s\n", opts.PlanOutput)
+		}
+		return nil
+	}
+
+	// 状态文件记录已完成的行，用于中断后续扫。没有输出文件时放在源文件旁边，
+	// 只用 -i 且不输出Excel时不记录
+	statePath := opts.ExcelOutput
+	if statePath == "" && opts.SourceExcel != "" {
+		statePath = opts.SourceExcel
+	} else if statePath == "" {
+		statePath = opts.FilePath
+	}
+	var state *journal
+	if statePath != "" {
+		state, err = openJournal(journalPath(statePath), opts.Resume)
+		if err != nil {
+			return err
+		}
+		defer state.Close()
+	}
+
+	// 续扫时已完成的行不再扫描，结果取自状态文件，所有输出文件按源文件顺序重新生成。
+	// 失败、中断和超出授权范围的行不记为已完成，会重新扫描
+	replays := make(map[int]scanOutcome)
+	for i, info := range sourceInfos {
+		if entry, done := state.completed(info); done && info.OutOfScope == "" {
+			replays[i] = scanOutcome{index: i, info: info, result: entry.Result, start: entry.Start, duration: entry.Duration, replayed: true}
+		}
+	}
+	if len(replays) > 0 {
+		logf("已跳过 %d 条已完成的记录\n", len(replays))
+	}
+
+	// 结果Excel在整个运行期间保持打开
+	var excel *excelWriter
+	if opts.ExcelOutput != "" {
+		excel, err = openExcelWriter(opts.ExcelOutput)
+		if err != nil {
+			return fmt.Errorf("创建Excel文件时出错: %v", err)
+		}
+	}
+
+	// JSON/NDJSON/CSV输出
+	if opts.OutputBase == "" {
+		opts.OutputBase = "scan_result"
+		if opts.ExcelOutput != "" {
+			opts.OutputBase = strings.TrimSuffix(opts.ExcelOutput, filepath.Ext(opts.ExcelOutput))
+		}
+	}
+	writers, err := newResultWriters(opts.OutputFormats, opts.OutputBase)
+	if err != nil {
+		excel.Close()
+		return err
+	}
+
+	// HTML报告
+	if opts.HTMLOutput != "" {
+		writers = append(writers, &htmlWriter{filename: opts.HTMLOutput})
+	}
+
+	// 历史数据库，每次运行单独记录
+	if opts.DBPath != "" {
+		store, err := openSQLiteStore(opts.DBPath)
+		if err != nil {
+			excel.Close()
+			closeWriters(writers)
+			return err
+		}
+		source := opts.SourceExcel
+		if source == "" && opts.FilePath != "" {
+			source = opts.FilePath
+		} else if source == "" {
+			source = opts.IPList
+		}
+		w, err := newStoreWriter(store, source, opts.NmapArgs)
+		if err != nil {
+			store.Close()
+			excel.Close()
+			closeWriters(writers)
+			return err
+		}
+		writers = append(writers, w)
+	}
+
+	// Excel保存之后再记录到状态文件，进程意外退出时状态文件中不会有Excel中没有的行
+	var done []scanOutcome
+	recordDone := func() {
+		for _, o := range done {
+			if err := state.record(o); err != nil {
+				logf("%v\n", err)
+			}
+		}
+		done = nil
+	}
+
+	var totalDuration time.Duration
+	replay := func(i int) (scanOutcome, bool) {
+		o, ok := replays[i]
+		return o, ok
+	}
+	// 按照源文件的顺序处理所有记录
+	runScans(ctx, sourceInfos, replay, scanner, scanOpts, opts.Concurrency, opts.BatchSize, func(o scanOutcome) {
+		info := o.info
+		if o.notStarted {
+			return
+		}
+		interrupted := errors.Is(o.err, context.Canceled)
+
+		result := o.result
+		status, reason := classifyRow(info)
+		switch {
+		case status == statusNoIP, status == statusPortFilled:
+			// 没有IP和端口列已填写的行与原来一样只写入源信息
+		case status == statusFailed:
+			logf("%s 未扫描，%s\n", info.IP, reason)
+			o.err = errors.New(reason)
+			result = ScanResult{
+				OS:    []string{"扫描失败: " + o.err.Error()},
+				Ports: []PortInfo{},
+			}
+		case status != statusScanned:
+			logf("%s 未扫描，%s\n", info.IP, reason)
+			o.err = errors.New(reason)
+		case interrupted:
+			// 写入中断前已得到的部分结果
+			logf("扫描 %s 被中断\n", info.IP)
+			status = statusInterrupted
+			result.OS = append([]string{"扫描中断: 部分结果"}, result.OS...)
+		case o.err != nil:
+			logf("扫描 %s 时出错: %v\n", info.IP, o.err)
+			status = statusFailed
+			result = ScanResult{
+				OS:    []string{"扫描失败: " + o.err.Error()},
+				Ports: []PortInfo{},
+			}
+		}
+
+		if status == statusScanned || status == statusInterrupted {
+			if err := cves.apply(&result); err != nil {
+				logf("匹配 %s 的漏洞时出错: %v\n", info.IP, err)
+			}
+			rules.apply(info, &result)
+		}
+
+		saved := true
+		if excel != nil {
+			var err error
+			saved, err = excel.Write(info.IP, result, info)
+			if err != nil {
+				logf("写入 %s 的扫描结果时出错: %v\n", info.IP, err)
+			} else if status == statusScanned && !o.replayed {
+				logf("%s 的扫描结果已写入文件\n", info.IP)
+			}
+		}
+
+		rec := newHostRecord(o.index, info, result, status, o.err, o.start, o.duration)
+		for _, w := range writers {
+			if err := w.Write(rec); err != nil {
+				logf("%v\n", err)
+			}
+		}
+
+		// 只记录已完成的行，失败、中断、超出授权范围和重复的行续扫时重新处理
+		if !o.replayed && (status == statusScanned || status == statusNoIP || status == statusPortFilled) {
+			done = append(done, o)
+		}
+		if saved {
+			recordDone()
+		}
+		if status == statusScanned && !o.replayed {
+			totalDuration += o.duration
+		}
+	})
+
+	excelErr := excel.Close()
+	if excelErr != nil {
+		logf("%v\n", excelErr)
+	} else {
+		recordDone()
+	}
+	closeWriters(writers)
+
+	if ctx.Err() != nil {
+		logf("\n扫描已中断，可使用 -resume 继续未完成的记录\n")
+	} else if excelErr == nil {
+		// 正常结束后不再需要续扫，状态文件中有完整的扫描结果，不留在输出目录
+		if err := state.Remove(); err != nil {
+			logf("%v\n", err)
+		}
+	}
+	if opts.ExcelOutput != "" {
+		logf("\n所有扫描结果已保存到Excel文件: %s\n", opts.ExcelOutput)
+	}
+	if opts.HTMLOutput != "" {
+		logf("HTML报告已保存到: %s\n", opts.HTMLOutput)
+	}
+	logf("总耗时: %s\n", totalDuration)
+	return nil
+}
+
+func closeWriters(writers []resultWriter) {
+	for _, w := range writers {
+		if err := w.Close(); err != nil {
+			logf("%v\n", err)
+		}
+	}
+}
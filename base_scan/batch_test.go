@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+
+	nmapscan "github.com/helar52-xl/batch_scan_ip_base_nmap/nmap_scan"
+)
+
+// 生成源Excel，第一行为表头
+func writeSourceExcel(t *testing.T, rows [][]interface{}) string {
+	t.Helper()
+	f := excelize.NewFile()
+	defer f.Close()
+	for i, row := range rows {
+		if err := f.SetSheetRow("Sheet1", fmt.Sprintf("A%d", i+1), &row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	filename := filepath.Join(t.TempDir(), "input.xlsx")
+	if err := f.SaveAs(filename); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+// 用 testdata/replay 中录制的nmap结果跑完整流程，检查结果Excel
+func TestRunBatchReplay(t *testing.T) {
+	source := writeSourceExcel(t, [][]interface{}{
+		{"所属单位", "网站名称", "IP", "端口", "备注"},
+		{"单位A", "门户", "192.0.2.10", "", "生产"},
+		{"单位A", "备用", "192.0.2.11"},
+		{"单位B", "", "192.0.2.12", "443"},
+		{"单位B", "", "192.0.2.10"},
+		{"单位C", "没有IP"},
+	})
+
+	// 输出的 A/D/E/F/G/H/I/K/L 列，同一主机的多个端口行合并单元格，只有第一行有值
+	want := [][]string{
+		{"单位A", "192.0.2.10", "22", "ssh", "OpenSSH 7.4p1 Debian 10+deb9u7 (protocol 2.0)", "Linux 4.15 - 5.8", "生产", "open", "tcp"},
+		{"", "", "80", "http", "nginx 1.10.3", "", "", "open", "tcp"},
+		{"单位A", "192.0.2.11", "", "", "", "", "", "主机离线", ""},
+		{"单位B", "192.0.2.12", "", "", "", "", "", "端口列已填写，未扫描", ""},
+		{"单位B", "192.0.2.10", "", "", "", "", "", "重复的目标，未扫描: 与第1行相同", ""},
+		{"单位C", "", "", "", "", "", "", "", ""},
+	}
+
+	// 单个主机扫描和多个主机一批扫描的结果应相同
+	for _, batch := range []int{1, 2} {
+		output := filepath.Join(t.TempDir(), "result.xlsx")
+		err := runBatch(context.Background(), batchOptions{
+			SourceExcel: source,
+			NmapArgs:    "-sV -O",
+			ExcelOutput: output,
+			Concurrency: 2,
+			BatchSize:   batch,
+			Scanner:     &nmapscan.ReplayScanner{Dir: filepath.Join("testdata", "replay")},
+		})
+		if err != nil {
+			t.Fatalf("BatchSize=%d: %v", batch, err)
+		}
+		// 正常结束后删除状态文件
+		if _, err := os.Stat(journalPath(output)); !os.IsNotExist(err) {
+			t.Errorf("BatchSize=%d: 扫描完成后状态文件仍然存在: %v", batch, err)
+		}
+
+		f, err := excelize.OpenFile(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows, err := f.GetRows("Sheet1")
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rows) != len(want)+1 || !reflect.DeepEqual(rows[0], outputHeaders) {
+			t.Fatalf("BatchSize=%d: 结果 %d 行，表头 %q", batch, len(rows), rows[0])
+		}
+		for i, w := range want {
+			row := rows[i+1]
+			var got []string
+			for _, col := range []int{0, 3, 4, 5, 6, 7, 8, 10, 11} {
+				cell := ""
+				if col < len(row) {
+					cell = row[col]
+				}
+				got = append(got, cell)
+			}
+			if !reflect.DeepEqual(got, w) {
+				t.Errorf("BatchSize=%d 第%d行 = %q，应为 %q", batch, i+2, got, w)
+			}
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// 状态文件中的一条记录，对应源Excel中已完成的一行。续扫时由这些记录重新生成输出文件
+type journalEntry struct {
+	Index int `json:"index"`
+	// 源记录的序号和IP列的原始内容，与IP一起确定是哪一行，见 journalKey
+	Row      int           `json:"row"`
+	Target   string        `json:"target"`
+	Number   string        `json:"number"`
+	Name     string        `json:"name"`
+	IP       string        `json:"ip"`
+	Result   ScanResult    `json:"result"`
+	Start    time.Time     `json:"start"`
+	Duration time.Duration `json:"duration"`
+	// 旧版本也记录了扫描失败的行，有错误的记录视为未完成
+	Error string    `json:"error,omitempty"`
+	Time  time.Time `json:"time"`
+}
+
+// 状态文件中行的标识。域名解析、网段展开和授权范围检查后行的顺序可能与上次不同
+// (如DNS返回地址的顺序变化)，因此不按展开后的序号，而按源记录和扫描的地址对应。
+// 旧版本的记录没有源记录序号，续扫时会重新扫描
+type journalKey struct {
+	row    int
+	target string
+	ip     string
+}
+
+func keyOf(info ExcelInfo) journalKey {
+	return journalKey{row: info.SourceRow, target: info.SourceTarget, ip: info.IP}
+}
+
+// 扫描进度状态文件，每完成一行追加一条JSON记录
+type journal struct {
+	path string
+	file *os.File
+	done map[journalKey]journalEntry
+}
+
+// 状态文件放在输出文件旁边
+func journalPath(output string) string {
+	return output + ".state.json"
+}
+
+// 打开状态文件，resume为true时读取已有记录并继续追加，否则清空重新记录
+func openJournal(path string, resume bool) (*journal, error) {
+	j := &journal{path: path, done: make(map[journalKey]journalEntry)}
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if resume {
+		if err := j.load(); err != nil {
+			return nil, err
+		}
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+
+	file, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("打开状态文件失败: %v", err)
+	}
+	j.file = file
+	return j, nil
+}
+
+func (j *journal) load() error {
+	file, err := os.Open(j.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("读取状态文件失败: %v", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var entry journalEntry
+		// 进程中断时最后一行可能不完整，忽略即可，该行会被重新扫描
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		if entry.Row > 0 {
+			j.done[journalKey{row: entry.Row, target: entry.Target, ip: entry.IP}] = entry
+		}
+	}
+	return scanner.Err()
+}
+
+// 返回某行已完成的记录。源文件被修改后对应不上的行视为未完成，会重新扫描。
+// 未使用状态文件(j为nil)时所有行都视为未完成
+func (j *journal) completed(info ExcelInfo) (journalEntry, bool) {
+	if j == nil {
+		return journalEntry{}, false
+	}
+	entry, ok := j.done[keyOf(info)]
+	if !ok || entry.Error != "" {
+		return journalEntry{}, false
+	}
+	return entry, true
+}
+
+// 记录已完成的行，写入后立即落盘
+func (j *journal) record(o scanOutcome) error {
+	if j == nil {
+		return nil
+	}
+	entry := journalEntry{
+		Index:    o.index,
+		Row:      o.info.SourceRow,
+		Target:   o.info.SourceTarget,
+		Number:   o.info.Number,
+		Name:     o.info.Name,
+		IP:       o.info.IP,
+		Result:   o.result,
+		Start:    o.start,
+		Duration: o.duration,
+		Time:     time.Now(),
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("序列化状态记录失败: %v", err)
+	}
+	if _, err := j.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("写入状态文件失败: %v", err)
+	}
+	j.done[keyOf(o.info)] = entry
+	return j.file.Sync()
+}
+
+func (j *journal) Close() error {
+	return j.file.Close()
+}
+
+// 关闭并删除状态文件
+func (j *journal) Remove() error {
+	if j == nil {
+		return nil
+	}
+	j.file.Close()
+	if err := os.Remove(j.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("删除状态文件失败: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestJournalKeyedBySourceRow(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "result.xlsx.state.json")
+	j, err := openJournal(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 上次运行时 www.example.com 解析为 10.0.0.1、10.0.0.2，完成了第二个地址
+	scanned := ExcelInfo{Number: "单位A", Domain: "www.example.com", IP: "10.0.0.2", SourceRow: 3, SourceTarget: "www.example.com"}
+	if err := j.record(scanOutcome{index: 5, info: scanned, result: ScanResult{HostState: hostUp}}); err != nil {
+		t.Fatal(err)
+	}
+	j.Close()
+
+	j, err = openJournal(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+
+	tests := []struct {
+		info ExcelInfo
+		done bool
+	}{
+		// 本次DNS返回的顺序不同，展开后的序号变了，仍按源记录和地址对应
+		{scanned, true},
+		{ExcelInfo{IP: "10.0.0.1", SourceRow: 3, SourceTarget: "www.example.com"}, false},
+		// 源文件被修改，同一行的目标不同
+		{ExcelInfo{IP: "10.0.0.2", SourceRow: 3, SourceTarget: "10.0.0.0/30"}, false},
+		{ExcelInfo{IP: "10.0.0.2", SourceRow: 4, SourceTarget: "www.example.com"}, false},
+	}
+	for _, tt := range tests {
+		entry, done := j.completed(tt.info)
+		if done != tt.done {
+			t.Errorf("completed(%+v) = %v，应为 %v", tt.info, done, tt.done)
+		}
+		if done && entry.Result.HostState != hostUp {
+			t.Errorf("记录的结果 %+v", entry.Result)
+		}
+	}
+
+	if err := j.Remove(); err != nil {
+		t.Fatal(err)
+	}
+	if j, err := openJournal(path, true); err != nil || len(j.done) != 0 {
+		t.Errorf("删除后仍读到 %d 条记录, %v", len(j.done), err)
+	} else {
+		j.Close()
+	}
+}
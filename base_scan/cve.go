@@ -0,0 +1,678 @@
+package main
+
+import (
+	"compress/gzip"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const cveSchema = `
+CREATE TABLE IF NOT EXISTS cves (
+	id          TEXT PRIMARY KEY,
+	score       REAL NOT NULL,
+	description TEXT NOT NULL DEFAULT ''
+);
+CREATE TABLE IF NOT EXISTS cpe_matches (
+	cve_id         TEXT NOT NULL,
+	vendor         TEXT NOT NULL,
+	product        TEXT NOT NULL,
+	version        TEXT NOT NULL,
+	version_update TEXT NOT NULL DEFAULT '*',
+	start_incl     TEXT NOT NULL DEFAULT '',
+	start_excl     TEXT NOT NULL DEFAULT '',
+	end_incl       TEXT NOT NULL DEFAULT '',
+	end_excl       TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS idx_cpe_matches_product ON cpe_matches(product);
+CREATE INDEX IF NOT EXISTS idx_cpe_matches_cve ON cpe_matches(cve_id);
+CREATE TABLE IF NOT EXISTS feeds (
+	file        TEXT NOT NULL,
+	imported_at TEXT NOT NULL,
+	cves        INTEGER NOT NULL
+);
+`
+
+// 后来增加的列，旧漏洞库打开时补上，重新导入后才有准确的值
+var cveColumns = []struct{ table, column, def string }{
+	{"cpe_matches", "version_update", "TEXT NOT NULL DEFAULT '*'"},
+}
+
+// Excel单元格中最多列出的CVE数量
+const maxCVEsInCell = 50
+
+// 本地漏洞库，由 import-nvd 子命令从NVD的JSON数据导入
+type cveDB struct {
+	db *sql.DB
+	// 同一产品和版本的查询结果，扫描时同一服务会多次出现
+	cache map[string]cveLookup
+}
+
+// 一个端口匹配到的漏洞，CVEs按CVSS分数从高到低排列
+type cveMatch struct {
+	CVEs []string
+	CVSS float64
+}
+
+func openCVEDB(path string) (*cveDB, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("打开漏洞库失败: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(cveSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("初始化漏洞库失败: %v", err)
+	}
+	if err := addMissingColumns(db, cveColumns); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("初始化漏洞库失败: %v", err)
+	}
+	return &cveDB{db: db, cache: make(map[string]cveLookup)}, nil
+}
+
+func (c *cveDB) Close() error {
+	if c == nil {
+		return nil
+	}
+	return c.db.Close()
+}
+
+// CPE中用到的部分，Part为 a(应用)、o(操作系统)、h(硬件)，
+// Update为版本的更新号，如 openssh 7.4p1 的 p1
+type cpeName struct {
+	Part    string
+	Vendor  string
+	Product string
+	Version string
+	Update  string
+}
+
+// 解析 cpe:/a:openbsd:openssh:7.4 (nmap使用的2.2格式) 和
+// cpe:2.3:a:openbsd:openssh:7.4:*:*:*:*:*:*:* (NVD使用的2.3格式)
+func parseCPE(s string) (cpeName, bool) {
+	var fields []string
+	switch {
+	case strings.HasPrefix(s, "cpe:2.3:"):
+		fields = splitCPE23(strings.TrimPrefix(s, "cpe:2.3:"))
+	case strings.HasPrefix(s, "cpe:/"):
+		fields = strings.Split(strings.TrimPrefix(s, "cpe:/"), ":")
+	default:
+		return cpeName{}, false
+	}
+	if len(fields) < 3 || fields[2] == "" {
+		return cpeName{}, false
+	}
+	name := cpeName{Part: strings.ToLower(fields[0]), Vendor: strings.ToLower(fields[1]), Product: strings.ToLower(fields[2]), Version: "*", Update: "*"}
+	if len(fields) > 3 && fields[3] != "" {
+		name.Version = strings.ToLower(fields[3])
+	}
+	if len(fields) > 4 && fields[4] != "" {
+		name.Update = strings.ToLower(fields[4])
+	}
+	return name, true
+}
+
+// 2.3格式中 "\:" 等为转义字符
+func splitCPE23(s string) []string {
+	var fields []string
+	var cur strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s):
+			i++
+			cur.WriteByte(s[i])
+		case s[i] == ':':
+			fields = append(fields, cur.String())
+			cur.Reset()
+		default:
+			cur.WriteByte(s[i])
+		}
+	}
+	return append(fields, cur.String())
+}
+
+// 端口服务对应的CPE。优先使用nmap XML中的 <cpe>，没有时由产品名称和版本推导，
+// 此时不知道厂商，只按产品名称匹配
+func portCPEs(port PortInfo) []cpeName {
+	version := ""
+	if fields := strings.Fields(port.ProductVersion); len(fields) > 0 {
+		version = strings.ToLower(fields[0])
+	}
+
+	var names []cpeName
+	for _, s := range port.CPE {
+		name, ok := parseCPE(s)
+		if !ok {
+			continue
+		}
+		// nmap的CPE中经常没有版本，有更新号时与版本合并，如 7.4:p1 为 7.4p1。
+		// 识别出的版本只属于该服务本身，不能补到操作系统等其他CPE上
+		if name.Version == "*" && version != "" && name.Part == "a" && sameProduct(name.Product, port.Product) {
+			name.Version = version
+		} else if name.Update != "*" && name.Update != "-" {
+			name.Version += name.Update
+		}
+		name.Update = "*"
+		names = append(names, name)
+	}
+	if len(names) == 0 && port.Product != "" {
+		product := strings.ToLower(strings.Join(strings.Fields(port.Product), "_"))
+		names = append(names, cpeName{Part: "a", Vendor: "*", Product: product, Version: version, Update: "*"})
+	}
+	return names
+}
+
+// CPE的产品名是否与nmap识别出的产品名对应，如 openssh 与 OpenSSH、tomcat 与 Apache Tomcat
+func sameProduct(cpeProduct, product string) bool {
+	normalize := func(s string) string {
+		return strings.Map(func(r rune) rune {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				return unicode.ToLower(r)
+			}
+			return -1
+		}, s)
+	}
+	cpeProduct, product = normalize(cpeProduct), normalize(product)
+	return cpeProduct != "" && strings.Contains(product, cpeProduct)
+}
+
+// 查询端口服务的漏洞，不知道版本时不匹配
+func (c *cveDB) match(port PortInfo) (cveMatch, error) {
+	scores := make(map[string]float64)
+	for _, name := range portCPEs(port) {
+		if name.Version == "" || name.Version == "*" || name.Version == "-" {
+			continue
+		}
+		m, err := c.lookup(name)
+		if err != nil {
+			return cveMatch{}, err
+		}
+		for i, id := range m.CVEs {
+			scores[id] = m.Scores[i]
+		}
+	}
+
+	var result cveMatch
+	for id, score := range scores {
+		result.CVEs = append(result.CVEs, id)
+		if score > result.CVSS {
+			result.CVSS = score
+		}
+	}
+	sort.Slice(result.CVEs, func(i, j int) bool {
+		a, b := result.CVEs[i], result.CVEs[j]
+		if scores[a] != scores[b] {
+			return scores[a] > scores[b]
+		}
+		return a > b
+	})
+	return result, nil
+}
+
+// 单个CPE的查询结果，带各CVE的分数
+type cveLookup struct {
+	CVEs   []string
+	Scores []float64
+}
+
+func (c *cveDB) lookup(name cpeName) (cveLookup, error) {
+	key := name.Vendor + ":" + name.Product + ":" + name.Version
+	if cached, ok := c.cache[key]; ok {
+		return cached, nil
+	}
+
+	query := `SELECT m.cve_id, c.score, m.version, m.version_update, m.start_incl, m.start_excl, m.end_incl, m.end_excl
+		FROM cpe_matches m JOIN cves c ON c.id = m.cve_id WHERE m.product = ?`
+	args := []interface{}{name.Product}
+	if name.Vendor != "*" {
+		query += " AND m.vendor = ?"
+		args = append(args, name.Vendor)
+	}
+	rows, err := c.db.Query(query, args...)
+	if err != nil {
+		return cveLookup{}, fmt.Errorf("查询漏洞库失败: %v", err)
+	}
+	defer rows.Close()
+
+	var result cveLookup
+	seen := make(map[string]bool)
+	for rows.Next() {
+		var id string
+		var score float64
+		var r versionRange
+		if err := rows.Scan(&id, &score, &r.Version, &r.Update, &r.StartIncl, &r.StartExcl, &r.EndIncl, &r.EndExcl); err != nil {
+			return cveLookup{}, fmt.Errorf("查询漏洞库失败: %v", err)
+		}
+		if seen[id] || !r.contains(name.Version) {
+			continue
+		}
+		seen[id] = true
+		result.CVEs = append(result.CVEs, id)
+		result.Scores = append(result.Scores, score)
+	}
+	if err := rows.Err(); err != nil {
+		return cveLookup{}, fmt.Errorf("查询漏洞库失败: %v", err)
+	}
+	c.cache[key] = result
+	return result, nil
+}
+
+// NVD中受影响的版本，Version为具体版本或 "*"，"*" 时由范围限定。
+// Update为具体版本的更新号，"*" 为任意，"-" 为没有更新号
+type versionRange struct {
+	Version   string
+	Update    string
+	StartIncl string
+	StartExcl string
+	EndIncl   string
+	EndExcl   string
+}
+
+func (r versionRange) contains(v string) bool {
+	if r.Version != "*" && r.Version != "" {
+		// NVD中有的把更新号写在版本中(openssl 1.1.1k)，有的单独列出(openssh 7.4 p1)
+		if compareVersions(v, r.Version) == 0 && (r.Update == "*" || r.Update == "" || r.Update == "-") {
+			return true
+		}
+		base, update := splitVersionUpdate(v)
+		if update == "" || compareVersions(base, r.Version) != 0 {
+			return false
+		}
+		return r.Update == "*" || r.Update == "" || strings.EqualFold(update, r.Update)
+	}
+	if r.StartIncl != "" && compareVersions(v, r.StartIncl) < 0 {
+		return false
+	}
+	if r.StartExcl != "" && compareVersions(v, r.StartExcl) <= 0 {
+		return false
+	}
+	if r.EndIncl != "" && compareVersions(v, r.EndIncl) > 0 {
+		return false
+	}
+	if r.EndExcl != "" && compareVersions(v, r.EndExcl) >= 0 {
+		return false
+	}
+	return true
+}
+
+// 比较版本号，按数字段和字母段逐段比较，如 7.4 < 7.4p1 < 7.5
+func compareVersions(a, b string) int {
+	ta, tb := versionTokens(a), versionTokens(b)
+	for i := 0; i < len(ta) && i < len(tb); i++ {
+		na, errA := strconv.Atoi(ta[i])
+		nb, errB := strconv.Atoi(tb[i])
+		switch {
+		case errA == nil && errB == nil:
+			if na != nb {
+				if na < nb {
+					return -1
+				}
+				return 1
+			}
+		case errA == nil:
+			// 数字段大于字母段，如 1.0 > 1.beta
+			return 1
+		case errB == nil:
+			return -1
+		default:
+			if c := strings.Compare(ta[i], tb[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	switch {
+	case len(ta) < len(tb):
+		return -1
+	case len(ta) > len(tb):
+		return 1
+	}
+	return 0
+}
+
+// 将版本拆分为数字部分和更新号，如 7.4p1 为 7.4 和 p1，没有更新号时update为空
+func splitVersionUpdate(v string) (base, update string) {
+	i := strings.IndexFunc(v, func(r rune) bool { return r != '.' && !unicode.IsDigit(r) })
+	if i <= 0 {
+		return v, ""
+	}
+	base = strings.TrimRight(v[:i], ".")
+	update = strings.TrimLeft(v[i:], "-_.")
+	if base == "" || update == "" {
+		return v, ""
+	}
+	return base, update
+}
+
+func versionTokens(v string) []string {
+	var tokens []string
+	var cur []rune
+	digit := false
+	flush := func() {
+		if len(cur) > 0 {
+			tokens = append(tokens, string(cur))
+			cur = cur[:0]
+		}
+	}
+	for _, r := range strings.ToLower(v) {
+		switch {
+		case unicode.IsDigit(r):
+			if !digit {
+				flush()
+			}
+			digit = true
+			cur = append(cur, r)
+		case unicode.IsLetter(r):
+			if digit {
+				flush()
+			}
+			digit = false
+			cur = append(cur, r)
+		default:
+			flush()
+		}
+	}
+	flush()
+	return tokens
+}
+
+// 为结果中的每个端口匹配漏洞
+func (c *cveDB) apply(result *ScanResult) error {
+	if c == nil {
+		return nil
+	}
+	for i := range result.Ports {
+		port := &result.Ports[i]
+		m, err := c.match(*port)
+		if err != nil {
+			return err
+		}
+		port.CVEs = m.CVEs
+		port.CVSS = m.CVSS
+	}
+	return nil
+}
+
+// Excel中显示的CVE列表，过多时只列出分数最高的部分
+func cveCellText(cves []string) string {
+	if len(cves) <= maxCVEsInCell {
+		return strings.Join(cves, "\n")
+	}
+	return strings.Join(cves[:maxCVEsInCell], "\n") + fmt.Sprintf("\n...等共%d个", len(cves))
+}
+
+// NVD JSON数据中用到的字段，同时兼容1.1版的数据文件(CVE_Items)和2.0版API的结果(vulnerabilities)
+type nvdItem struct {
+	CVE struct {
+		Meta struct {
+			ID string `json:"ID"`
+		} `json:"CVE_data_meta"`
+		Description struct {
+			Data []struct {
+				Lang  string `json:"lang"`
+				Value string `json:"value"`
+			} `json:"description_data"`
+		} `json:"description"`
+
+		// 2.0版
+		ID           string `json:"id"`
+		Descriptions []struct {
+			Lang  string `json:"lang"`
+			Value string `json:"value"`
+		} `json:"descriptions"`
+		Metrics struct {
+			V31 []nvdMetric `json:"cvssMetricV31"`
+			V30 []nvdMetric `json:"cvssMetricV30"`
+			V40 []nvdMetric `json:"cvssMetricV40"`
+			V2  []nvdMetric `json:"cvssMetricV2"`
+		} `json:"metrics"`
+		Configurations []struct {
+			Nodes []nvdNode `json:"nodes"`
+		} `json:"configurations"`
+	} `json:"cve"`
+
+	// 1.1版
+	Impact struct {
+		V3 struct {
+			CVSS struct {
+				BaseScore float64 `json:"baseScore"`
+			} `json:"cvssV3"`
+		} `json:"baseMetricV3"`
+		V2 struct {
+			CVSS struct {
+				BaseScore float64 `json:"baseScore"`
+			} `json:"cvssV2"`
+		} `json:"baseMetricV2"`
+	} `json:"impact"`
+	Configurations struct {
+		Nodes []nvdNode `json:"nodes"`
+	} `json:"configurations"`
+}
+
+type nvdMetric struct {
+	Data struct {
+		BaseScore float64 `json:"baseScore"`
+	} `json:"cvssData"`
+}
+
+type nvdNode struct {
+	Children   []nvdNode     `json:"children"`
+	CPEMatch11 []nvdCPEMatch `json:"cpe_match"`
+	CPEMatch20 []nvdCPEMatch `json:"cpeMatch"`
+}
+
+type nvdCPEMatch struct {
+	Vulnerable bool   `json:"vulnerable"`
+	URI        string `json:"cpe23Uri"`
+	Criteria   string `json:"criteria"`
+	StartIncl  string `json:"versionStartIncluding"`
+	StartExcl  string `json:"versionStartExcluding"`
+	EndIncl    string `json:"versionEndIncluding"`
+	EndExcl    string `json:"versionEndExcluding"`
+}
+
+func (item *nvdItem) id() string {
+	if item.CVE.ID != "" {
+		return item.CVE.ID
+	}
+	return item.CVE.Meta.ID
+}
+
+// 优先使用CVSS 3.x的分数
+func (item *nvdItem) score() float64 {
+	m := item.CVE.Metrics
+	for _, metrics := range [][]nvdMetric{m.V31, m.V30, m.V40, m.V2} {
+		if len(metrics) > 0 {
+			return metrics[0].Data.BaseScore
+		}
+	}
+	if s := item.Impact.V3.CVSS.BaseScore; s > 0 {
+		return s
+	}
+	return item.Impact.V2.CVSS.BaseScore
+}
+
+func (item *nvdItem) description() string {
+	for _, d := range item.CVE.Descriptions {
+		if d.Lang == "en" {
+			return d.Value
+		}
+	}
+	for _, d := range item.CVE.Description.Data {
+		if d.Lang == "en" {
+			return d.Value
+		}
+	}
+	return ""
+}
+
+// 受影响的CPE，只取标记为 vulnerable 的
+func (item *nvdItem) matches() []nvdCPEMatch {
+	var result []nvdCPEMatch
+	var walk func(nodes []nvdNode)
+	walk = func(nodes []nvdNode) {
+		for _, n := range nodes {
+			for _, m := range append(n.CPEMatch11, n.CPEMatch20...) {
+				if m.Vulnerable {
+					result = append(result, m)
+				}
+			}
+			walk(n.Children)
+		}
+	}
+	walk(item.Configurations.Nodes)
+	for _, c := range item.CVE.Configurations {
+		walk(c.Nodes)
+	}
+	return result
+}
+
+// 导入一个NVD JSON文件(可以是.gz压缩)，已有的CVE会被更新
+func (c *cveDB) importFeed(filename string) (int, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return 0, fmt.Errorf("打开文件失败: %v", err)
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	if strings.HasSuffix(filename, ".gz") {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return 0, fmt.Errorf("解压失败: %v", err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	tx, err := c.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	count := 0
+	err = decodeNVDItems(r, func(item *nvdItem) error {
+		id := item.id()
+		if id == "" {
+			return nil
+		}
+		if _, err := tx.Exec(`INSERT OR REPLACE INTO cves (id, score, description) VALUES (?, ?, ?)`,
+			id, item.score(), item.description()); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM cpe_matches WHERE cve_id = ?`, id); err != nil {
+			return err
+		}
+		for _, m := range item.matches() {
+			uri := m.Criteria
+			if uri == "" {
+				uri = m.URI
+			}
+			name, ok := parseCPE(uri)
+			if !ok {
+				continue
+			}
+			if _, err := tx.Exec(`INSERT INTO cpe_matches (cve_id, vendor, product, version, version_update, start_incl, start_excl, end_incl, end_excl)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`, id, name.Vendor, name.Product, name.Version, name.Update,
+				m.StartIncl, m.StartExcl, m.EndIncl, m.EndExcl); err != nil {
+				return err
+			}
+		}
+		count++
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(`INSERT INTO feeds (file, imported_at, cves) VALUES (?, ?, ?)`,
+		filename, formatTime(time.Now()), count); err != nil {
+		return 0, err
+	}
+	return count, tx.Commit()
+}
+
+// 逐条读取 CVE_Items 或 vulnerabilities 数组，不把整个文件读入内存
+func decodeNVDItems(r io.Reader, handle func(*nvdItem) error) error {
+	dec := json.NewDecoder(r)
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return errors.New("不是NVD JSON数据")
+	}
+	found := false
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return fmt.Errorf("解析JSON失败: %v", err)
+		}
+		key, _ := tok.(string)
+		if key != "CVE_Items" && key != "vulnerabilities" {
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return fmt.Errorf("解析JSON失败: %v", err)
+			}
+			continue
+		}
+
+		found = true
+		if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+			return fmt.Errorf("解析JSON失败: %s 不是数组", key)
+		}
+		for dec.More() {
+			var item nvdItem
+			if err := dec.Decode(&item); err != nil {
+				return fmt.Errorf("解析JSON失败: %v", err)
+			}
+			if err := handle(&item); err != nil {
+				return err
+			}
+		}
+		if _, err := dec.Token(); err != nil {
+			return fmt.Errorf("解析JSON失败: %v", err)
+		}
+	}
+	if !found {
+		return errors.New("没有找到 CVE_Items 或 vulnerabilities")
+	}
+	return nil
+}
+
+// import-nvd 子命令: 将下载的NVD JSON数据导入本地漏洞库
+func runImportNVD(args []string) {
+	fs := flag.NewFlagSet("import-nvd", flag.ExitOnError)
+	dbPath := fs.String("db", "nvd.db", "本地漏洞库路径")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "用法: base_scan import-nvd [-db nvd.db] nvdcve-1.1-2024.json.gz ...\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return
+	}
+
+	db, err := openCVEDB(*dbPath)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return
+	}
+	defer db.Close()
+
+	for _, file := range fs.Args() {
+		start := time.Now()
+		n, err := db.importFeed(file)
+		if err != nil {
+			fmt.Printf("导入 %s 失败: %v\n", file, err)
+			continue
+		}
+		fmt.Printf("已导入 %s: %d 个CVE，耗时 %s\n", file, n, time.Since(start).Round(time.Millisecond))
+	}
+}
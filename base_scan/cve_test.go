@@ -0,0 +1,251 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseCPE(t *testing.T) {
+	tests := []struct {
+		in   string
+		want cpeName
+		ok   bool
+	}{
+		{"cpe:/a:openbsd:openssh:7.4", cpeName{"a", "openbsd", "openssh", "7.4", "*"}, true},
+		{"cpe:/a:OpenBSD:OpenSSH", cpeName{"a", "openbsd", "openssh", "*", "*"}, true},
+		{"cpe:/a:openbsd:openssh:7.4:p1", cpeName{"a", "openbsd", "openssh", "7.4", "p1"}, true},
+		{"cpe:2.3:a:openbsd:openssh:7.4:p1:*:*:*:*:*:*", cpeName{"a", "openbsd", "openssh", "7.4", "p1"}, true},
+		{"cpe:2.3:a:openbsd:openssh:*:*:*:*:*:*:*:*", cpeName{"a", "openbsd", "openssh", "*", "*"}, true},
+		{`cpe:2.3:a:lexmark:x\:y:1.0:-:*:*:*:*:*:*`, cpeName{"a", "lexmark", "x:y", "1.0", "-"}, true},
+		{"cpe:/o:linux:linux_kernel", cpeName{"o", "linux", "linux_kernel", "*", "*"}, true},
+		{"cpe:/a:openbsd", cpeName{}, false},
+		{"openssh 7.4", cpeName{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseCPE(tt.in)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("parseCPE(%q) = %+v, %v，应为 %+v, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestSplitCPE23(t *testing.T) {
+	got := splitCPE23(`a:vendor:prod\:uct:1\.0:*`)
+	want := []string{"a", "vendor", "prod:uct", "1.0", "*"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("splitCPE23 = %q，应为 %q", got, want)
+	}
+}
+
+func TestPortCPEs(t *testing.T) {
+	tests := []struct {
+		port PortInfo
+		want []cpeName
+	}{
+		{
+			PortInfo{Product: "OpenSSH", ProductVersion: "7.4p1 Debian 10+deb9u7", CPE: []string{"cpe:/a:openbsd:openssh"}},
+			[]cpeName{{"a", "openbsd", "openssh", "7.4p1", "*"}},
+		},
+		{
+			PortInfo{Product: "OpenSSH", ProductVersion: "7.4p1", CPE: []string{"cpe:/a:openbsd:openssh:7.4:p1"}},
+			[]cpeName{{"a", "openbsd", "openssh", "7.4p1", "*"}},
+		},
+		// 服务的版本不补到操作系统的CPE和产品不同的CPE上
+		{
+			PortInfo{Product: "nginx", ProductVersion: "1.18.0", CPE: []string{"cpe:/a:igor_sysoev:nginx", "cpe:/o:linux:linux_kernel", "cpe:/a:openssl:openssl"}},
+			[]cpeName{{"a", "igor_sysoev", "nginx", "1.18.0", "*"}, {"o", "linux", "linux_kernel", "*", "*"}, {"a", "openssl", "openssl", "*", "*"}},
+		},
+		{
+			PortInfo{Product: "Apache Tomcat", ProductVersion: "9.0.31", CPE: []string{"cpe:/a:apache:tomcat"}},
+			[]cpeName{{"a", "apache", "tomcat", "9.0.31", "*"}},
+		},
+		{
+			PortInfo{Product: "Apache httpd", ProductVersion: "2.4.41"},
+			[]cpeName{{"a", "*", "apache_httpd", "2.4.41", "*"}},
+		},
+		{PortInfo{Service: "http"}, nil},
+	}
+	for _, tt := range tests {
+		if got := portCPEs(tt.port); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("portCPEs(%+v) = %+v，应为 %+v", tt.port, got, tt.want)
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"7.4", "7.4", 0},
+		{"7.4", "7.5", -1},
+		{"7.10", "7.9", 1},
+		{"7.4", "7.4p1", -1},
+		{"7.4p1", "7.4p2", -1},
+		{"7.4p1", "7.5", -1},
+		{"1.0", "1.beta", 1},
+		{"1.1.1k", "1.1.1l", -1},
+		{"2.4.41", "2.4.041", 0},
+	}
+	for _, tt := range tests {
+		if got := compareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareVersions(%q, %q) = %d，应为 %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestVersionRangeContains(t *testing.T) {
+	tests := []struct {
+		r    versionRange
+		v    string
+		want bool
+	}{
+		{versionRange{Version: "7.4", Update: "*"}, "7.4", true},
+		{versionRange{Version: "7.4", Update: "*"}, "7.4p1", true},
+		{versionRange{Version: "7.4", Update: "p1"}, "7.4p1", true},
+		{versionRange{Version: "7.4", Update: "p1"}, "7.4p2", false},
+		{versionRange{Version: "7.4", Update: "p1"}, "7.4", false},
+		{versionRange{Version: "7.4", Update: "-"}, "7.4", true},
+		{versionRange{Version: "7.4", Update: "-"}, "7.4p1", false},
+		{versionRange{Version: "1.1.1k", Update: "*"}, "1.1.1k", true},
+		{versionRange{Version: "1.1.1k", Update: "*"}, "1.1.1l", false},
+		{versionRange{Version: "*", StartIncl: "7.0", EndExcl: "7.5"}, "7.4p1", true},
+		{versionRange{Version: "*", StartIncl: "7.0", EndExcl: "7.5"}, "7.5", false},
+		{versionRange{Version: "*", StartExcl: "7.0", EndIncl: "7.5"}, "7.0", false},
+		{versionRange{Version: "*", StartExcl: "7.0", EndIncl: "7.5"}, "7.5", true},
+		{versionRange{Version: "*"}, "1.0", true},
+	}
+	for _, tt := range tests {
+		if got := tt.r.contains(tt.v); got != tt.want {
+			t.Errorf("%+v.contains(%q) = %v，应为 %v", tt.r, tt.v, got, tt.want)
+		}
+	}
+}
+
+const nvd11Feed = `{
+  "CVE_data_type": "CVE",
+  "CVE_Items": [{
+    "cve": {
+      "CVE_data_meta": {"ID": "CVE-2017-15906"},
+      "description": {"description_data": [{"lang": "en", "value": "sftp-server read-only bypass"}]}
+    },
+    "configurations": {"nodes": [{"cpe_match": [
+      {"vulnerable": true, "cpe23Uri": "cpe:2.3:a:openbsd:openssh:*:*:*:*:*:*:*:*", "versionEndExcluding": "7.6"}
+    ]}]},
+    "impact": {"baseMetricV3": {"cvssV3": {"baseScore": 5.3}}, "baseMetricV2": {"cvssV2": {"baseScore": 5.0}}}
+  }]
+}`
+
+const nvd20Feed = `{
+  "resultsPerPage": 1,
+  "vulnerabilities": [{
+    "cve": {
+      "id": "CVE-2018-15473",
+      "descriptions": [{"lang": "es", "value": "..."}, {"lang": "en", "value": "user enumeration"}],
+      "metrics": {"cvssMetricV31": [{"cvssData": {"baseScore": 5.3}}], "cvssMetricV2": [{"cvssData": {"baseScore": 5.0}}]},
+      "configurations": [{"nodes": [{"cpeMatch": [
+        {"vulnerable": true, "criteria": "cpe:2.3:a:openbsd:openssh:7.4:p1:*:*:*:*:*:*"},
+        {"vulnerable": false, "criteria": "cpe:2.3:o:debian:debian_linux:9.0:*:*:*:*:*:*:*"}
+      ]}]}]
+    }
+  }]
+}`
+
+// 只有版本上限的内核漏洞，内核CPE错误地带上服务版本时就会匹配
+const nvdKernelFeed = `{
+  "CVE_Items": [{
+    "cve": {
+      "CVE_data_meta": {"ID": "CVE-2021-33909"},
+      "description": {"description_data": [{"lang": "en", "value": "seq_file size_t overflow"}]}
+    },
+    "configurations": {"nodes": [{"cpe_match": [
+      {"vulnerable": true, "cpe23Uri": "cpe:2.3:o:linux:linux_kernel:*:*:*:*:*:*:*:*", "versionEndExcluding": "5.13.4"}
+    ]}]},
+    "impact": {"baseMetricV3": {"cvssV3": {"baseScore": 7.8}}}
+  }]
+}`
+
+func TestDecodeNVDItems(t *testing.T) {
+	for _, feed := range []string{nvd11Feed, nvd20Feed} {
+		var items []*nvdItem
+		err := decodeNVDItems(strings.NewReader(feed), func(item *nvdItem) error {
+			items = append(items, item)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(items) != 1 {
+			t.Fatalf("读出 %d 条，应为 1 条", len(items))
+		}
+		item := items[0]
+		if item.id() == "" || item.score() != 5.3 || item.description() == "" || item.description() == "..." {
+			t.Errorf("读出 id=%q score=%v description=%q", item.id(), item.score(), item.description())
+		}
+		if m := item.matches(); len(m) != 1 {
+			t.Errorf("%s 受影响的CPE %+v，应只有1个", item.id(), m)
+		}
+	}
+
+	if err := decodeNVDItems(strings.NewReader(`{"items": []}`), func(*nvdItem) error { return nil }); err == nil {
+		t.Error("没有 CVE_Items 或 vulnerabilities 时应返回错误")
+	}
+	if err := decodeNVDItems(strings.NewReader(`[]`), func(*nvdItem) error { return nil }); err == nil {
+		t.Error("不是对象时应返回错误")
+	}
+}
+
+func TestCVEDBMatch(t *testing.T) {
+	dir := t.TempDir()
+	db, err := openCVEDB(filepath.Join(dir, "nvd.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for i, feed := range []string{nvd11Feed, nvd20Feed, nvdKernelFeed} {
+		file := filepath.Join(dir, []string{"1.1.json", "2.0.json", "kernel.json"}[i])
+		if err := os.WriteFile(file, []byte(feed), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.importFeed(file); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		version string
+		want    []string
+	}{
+		{"7.4p1 Debian 10+deb9u7", []string{"CVE-2018-15473", "CVE-2017-15906"}},
+		{"7.4p2", []string{"CVE-2017-15906"}},
+		{"7.6p1", nil},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		port := PortInfo{Product: "OpenSSH", ProductVersion: tt.version, CPE: []string{"cpe:/a:openbsd:openssh"}}
+		m, err := db.match(port)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(m.CVEs, tt.want) {
+			t.Errorf("OpenSSH %q 匹配到 %v，应为 %v", tt.version, m.CVEs, tt.want)
+		}
+	}
+
+	// 与 testdata/replay 中的ssh端口一样带有没有版本的内核CPE，服务版本不能当作内核版本
+	for _, port := range []PortInfo{
+		{Product: "nginx", ProductVersion: "1.18.0", CPE: []string{"cpe:/a:igor_sysoev:nginx", "cpe:/o:linux:linux_kernel"}},
+		{Product: "OpenSSH", ProductVersion: "7.6p1", CPE: []string{"cpe:/a:openbsd:openssh:7.6p1", "cpe:/o:linux:linux_kernel"}},
+	} {
+		m, err := db.match(port)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(m.CVEs) != 0 {
+			t.Errorf("%s %s 匹配到 %v，操作系统CPE不应匹配", port.Product, port.ProductVersion, m.CVEs)
+		}
+	}
+}
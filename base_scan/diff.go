@@ -0,0 +1,478 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// 一个端口在某次扫描中的状态
+type portSnapshot struct {
+	Port     string `json:"port"`
+	Protocol string `json:"protocol"`
+	State    string `json:"state"`
+	Service  string `json:"service"`
+	Version  string `json:"version"`
+}
+
+// 一个主机在某次扫描中的结果
+type hostSnapshot struct {
+	IP     string
+	Number string
+	OS     string
+	State  string // 主机状态 up/down，为空表示未知(旧版本的结果文件)
+	Failed bool   // 扫描失败或中断，端口信息不可信
+	// 超出授权范围、端口列已填写、目标重复等原因没有扫描，没有端口信息
+	Skipped bool
+	Ports   map[string]portSnapshot
+}
+
+// 端口的服务或版本发生变化
+type portChange struct {
+	Port       string `json:"port"`
+	Protocol   string `json:"protocol"`
+	OldService string `json:"old_service"`
+	NewService string `json:"new_service"`
+	OldVersion string `json:"old_version"`
+	NewVersion string `json:"new_version"`
+}
+
+type hostDiff struct {
+	IP          string         `json:"ip"`
+	Number      string         `json:"number"`
+	NewHost     bool           `json:"new_host,omitempty"`
+	RemovedHost bool           `json:"removed_host,omitempty"`
+	Opened      []portSnapshot `json:"opened,omitempty"`
+	Closed      []portSnapshot `json:"closed,omitempty"`
+	Changed     []portChange   `json:"changed,omitempty"`
+	HostDown    bool           `json:"host_down,omitempty"`
+	OSChanged   bool           `json:"os_changed,omitempty"`
+	OldOS       string         `json:"old_os,omitempty"`
+	NewOS       string         `json:"new_os,omitempty"`
+	Note        string         `json:"note,omitempty"`
+}
+
+type diffSummary struct {
+	Hosts     int `json:"hosts"`
+	Opened    int `json:"opened"`
+	Closed    int `json:"closed"`
+	Changed   int `json:"changed"`
+	HostsDown int `json:"hosts_down"`
+	OSChanged int `json:"os_changed"`
+}
+
+type diffReport struct {
+	Old         string      `json:"old"`
+	New         string      `json:"new"`
+	GeneratedAt time.Time   `json:"generated_at"`
+	Summary     diffSummary `json:"summary"`
+	Hosts       []hostDiff  `json:"hosts"`
+}
+
+// diff 子命令: 比较两次扫描结果，出现新开放端口时以退出码1结束
+func runDiff(args []string) {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	oldExcel := fs.String("old", "", "旧的结果Excel文件(由 -e 生成)")
+	newExcel := fs.String("new", "", "新的结果Excel文件(由 -e 生成)")
+	dbPath := fs.String("db", "", "扫描历史数据库，配合 -old-run/-new-run 使用")
+	oldRun := fs.Int64("old-run", 0, "数据库中旧的运行ID")
+	newRun := fs.Int64("new-run", 0, "数据库中新的运行ID")
+	excelOutput := fs.String("e", "", "差异报告Excel文件")
+	jsonOutput := fs.String("json", "", "差异汇总JSON文件")
+	fs.Parse(args)
+
+	var oldHosts, newHosts map[string]*hostSnapshot
+	var oldName, newName string
+	var err error
+	switch {
+	case *oldExcel != "" && *newExcel != "":
+		oldName, newName = *oldExcel, *newExcel
+		if oldHosts, err = loadResultExcel(*oldExcel); err == nil {
+			newHosts, err = loadResultExcel(*newExcel)
+		}
+	case *dbPath != "" && *oldRun > 0 && *newRun > 0:
+		oldName, newName = fmt.Sprintf("run %d", *oldRun), fmt.Sprintf("run %d", *newRun)
+		var store *sqliteStore
+		if store, err = openSQLiteStore(*dbPath); err == nil {
+			if oldHosts, err = loadStoredRun(store, *oldRun); err == nil {
+				newHosts, err = loadStoredRun(store, *newRun)
+			}
+			store.Close()
+		}
+	default:
+		fmt.Println("请使用 -old/-new 指定两个结果Excel文件，或使用 -db 和 -old-run/-new-run 指定两次运行")
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(2)
+	}
+
+	report := diffSnapshots(oldHosts, newHosts)
+	report.Old, report.New = oldName, newName
+	printDiff(report)
+
+	if *excelOutput != "" {
+		if err := exportDiffExcel(report, *excelOutput); err != nil {
+			fmt.Printf("写入差异报告失败: %v\n", err)
+			os.Exit(2)
+		}
+		fmt.Printf("差异报告已保存到: %s\n", *excelOutput)
+	}
+	if *jsonOutput != "" {
+		data, err := json.MarshalIndent(report, "", "    ")
+		if err == nil {
+			err = os.WriteFile(*jsonOutput, data, 0644)
+		}
+		if err != nil {
+			fmt.Printf("写入差异汇总失败: %v\n", err)
+			os.Exit(2)
+		}
+		fmt.Printf("差异汇总已保存到: %s\n", *jsonOutput)
+	}
+
+	if report.Summary.Opened > 0 {
+		os.Exit(1)
+	}
+}
+
+// 读取 excelWriter 生成的结果文件。合并单元格只有第一行有值，
+// 因此IP、所属单位、操作系统、主机状态沿用上一行。
+// 没有扫描的行(状态列见 emptyRowState)不覆盖同一IP已扫描的结果
+func loadResultExcel(filename string) (map[string]*hostSnapshot, error) {
+	f, err := excelize.OpenFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("打开Excel文件失败: %v", err)
+	}
+	defer f.Close()
+
+	rows, err := f.GetRows("Sheet1")
+	if err != nil {
+		return nil, fmt.Errorf("读取工作表失败: %v", err)
+	}
+
+	hosts := make(map[string]*hostSnapshot)
+	var current *hostSnapshot
+	for i := 1; i < len(rows); i++ {
+		row := make([]string, len(outputHeaders))
+		copy(row, rows[i])
+
+		if row[3] != "" && isNotScannedState(row[10]) {
+			if hosts[row[3]] == nil {
+				hosts[row[3]] = &hostSnapshot{IP: row[3], Number: row[0], Skipped: true, Ports: make(map[string]portSnapshot)}
+			}
+			current = nil
+			continue
+		}
+		if row[3] != "" {
+			current = hosts[row[3]]
+			if current == nil || current.Skipped {
+				current = &hostSnapshot{IP: row[3], Number: row[0], OS: strings.TrimSpace(row[7]),
+					State: excelHostState(row[19]), Ports: make(map[string]portSnapshot)}
+				hosts[row[3]] = current
+			}
+			current.Failed = current.Failed || strings.HasPrefix(row[7], "扫描失败") || strings.HasPrefix(row[7], "扫描中断")
+		} else if row[0] != "" || row[1] != "" || row[2] != "" {
+			// 没有IP的行
+			current = nil
+		}
+		if current == nil || row[4] == "" {
+			continue
+		}
+
+		port := portSnapshot{Port: row[4], Service: row[5], Version: row[6], State: row[10], Protocol: row[11]}
+		current.Ports[port.key()] = port
+	}
+	return hosts, nil
+}
+
+// 主机状态列为 "up (echo-reply)" 的形式，只取状态
+func excelHostState(cell string) string {
+	state, _, _ := strings.Cut(strings.TrimSpace(cell), " ")
+	return state
+}
+
+// 从历史数据库读取某次运行
+func loadStoredRun(store resultStore, runID int64) (map[string]*hostSnapshot, error) {
+	records, err := store.Hosts(runID)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("运行 %d 没有记录", runID)
+	}
+
+	hosts := make(map[string]*hostSnapshot)
+	for _, rec := range records {
+		if rec.IP == "" {
+			continue
+		}
+		skipped := rec.Status == statusOutOfScope || rec.Status == statusPortFilled || rec.Status == statusDuplicate
+		if existing := hosts[rec.IP]; existing != nil && (skipped || !existing.Skipped) {
+			continue
+		}
+		host := &hostSnapshot{
+			IP:      rec.IP,
+			Number:  rec.Number,
+			OS:      strings.TrimSpace(strings.Join(rec.OS, "\n")),
+			State:   rec.HostState,
+			Failed:  rec.Status == statusFailed || rec.Status == statusInterrupted,
+			Skipped: skipped,
+			Ports:   make(map[string]portSnapshot),
+		}
+		for _, p := range rec.Ports {
+			port := portSnapshot{Port: p.Port, Protocol: p.Protocol, State: p.State,
+				Service: strings.TrimSuffix(p.Service, "?"), Version: p.Version}
+			host.Ports[port.key()] = port
+		}
+		hosts[rec.IP] = host
+	}
+	return hosts, nil
+}
+
+func (p portSnapshot) key() string {
+	return p.Port + "/" + p.Protocol
+}
+
+func (p portSnapshot) open() bool {
+	return p.State == "open"
+}
+
+// 只比较开放的端口
+func (h *hostSnapshot) openPorts() map[string]portSnapshot {
+	open := make(map[string]portSnapshot)
+	if h == nil {
+		return open
+	}
+	for key, p := range h.Ports {
+		if p.open() {
+			open[key] = p
+		}
+	}
+	return open
+}
+
+func diffSnapshots(oldHosts, newHosts map[string]*hostSnapshot) diffReport {
+	report := diffReport{GeneratedAt: time.Now(), Hosts: make([]hostDiff, 0)}
+
+	ips := make(map[string]bool)
+	for ip := range oldHosts {
+		ips[ip] = true
+	}
+	for ip := range newHosts {
+		ips[ip] = true
+	}
+	sorted := make([]string, 0, len(ips))
+	for ip := range ips {
+		sorted = append(sorted, ip)
+	}
+	sort.Strings(sorted)
+
+	for _, ip := range sorted {
+		oldHost, newHost := oldHosts[ip], newHosts[ip]
+		d := hostDiff{IP: ip, NewHost: oldHost == nil, RemovedHost: newHost == nil}
+		if newHost != nil {
+			d.Number = newHost.Number
+		} else {
+			d.Number = oldHost.Number
+		}
+
+		// 任意一次扫描失败或没有扫描时不比较端口，避免把失败误报为端口关闭/开放
+		if (oldHost != nil && oldHost.Failed) || (newHost != nil && newHost.Failed) {
+			d.Note = "其中一次扫描失败或中断，未比较端口"
+			report.Hosts = append(report.Hosts, d)
+			continue
+		}
+		if (oldHost != nil && oldHost.Skipped) || (newHost != nil && newHost.Skipped) {
+			d.Note = "其中一次没有扫描(超出授权范围、端口列已填写或目标重复)，未比较端口"
+			report.Hosts = append(report.Hosts, d)
+			continue
+		}
+
+		oldPorts, newPorts := oldHost.openPorts(), newHost.openPorts()
+		// 主机离线时端口都扫不到，单独报告，不把原来开放的端口算作关闭
+		if oldHost != nil && newHost != nil && newHost.State == hostDown && oldHost.State != hostDown {
+			d.HostDown = true
+			d.Note = "主机离线，未比较端口"
+			if len(oldPorts) > 0 {
+				var was []portSnapshot
+				for _, p := range oldPorts {
+					was = append(was, p)
+				}
+				sortPorts(was)
+				d.Note += "，原开放端口:"
+				for _, p := range was {
+					d.Note += " " + p.key()
+				}
+			}
+			report.Summary.HostsDown++
+			report.Hosts = append(report.Hosts, d)
+			continue
+		}
+		for key, p := range newPorts {
+			old, ok := oldPorts[key]
+			if !ok {
+				d.Opened = append(d.Opened, p)
+				continue
+			}
+			if old.Service != p.Service || old.Version != p.Version {
+				d.Changed = append(d.Changed, portChange{
+					Port: p.Port, Protocol: p.Protocol,
+					OldService: old.Service, NewService: p.Service,
+					OldVersion: old.Version, NewVersion: p.Version,
+				})
+			}
+		}
+		for key, p := range oldPorts {
+			if _, ok := newPorts[key]; !ok {
+				d.Closed = append(d.Closed, p)
+			}
+		}
+		sortPorts(d.Opened)
+		sortPorts(d.Closed)
+		sort.Slice(d.Changed, func(i, j int) bool { return portLess(d.Changed[i].Port, d.Changed[j].Port) })
+
+		// 任意一次没有识别出操作系统时不比较
+		if oldHost != nil && newHost != nil && oldHost.OS != "" && newHost.OS != "" && oldHost.OS != newHost.OS {
+			d.OSChanged, d.OldOS, d.NewOS = true, oldHost.OS, newHost.OS
+		}
+
+		if len(d.Opened)+len(d.Closed)+len(d.Changed) == 0 && !d.OSChanged && !d.NewHost && !d.RemovedHost {
+			continue
+		}
+		report.Summary.Opened += len(d.Opened)
+		report.Summary.Closed += len(d.Closed)
+		report.Summary.Changed += len(d.Changed)
+		if d.OSChanged {
+			report.Summary.OSChanged++
+		}
+		report.Hosts = append(report.Hosts, d)
+	}
+	report.Summary.Hosts = len(report.Hosts)
+	return report
+}
+
+func portLess(a, b string) bool {
+	x, _ := strconv.Atoi(a)
+	y, _ := strconv.Atoi(b)
+	return x < y
+}
+
+func sortPorts(ports []portSnapshot) {
+	sort.Slice(ports, func(i, j int) bool { return portLess(ports[i].Port, ports[j].Port) })
+}
+
+func printDiff(report diffReport) {
+	fmt.Printf("比较 %s -> %s\n", report.Old, report.New)
+	for _, d := range report.Hosts {
+		fmt.Printf("\n%s %s\n", d.IP, d.Number)
+		switch {
+		case d.NewHost:
+			fmt.Println("  新增主机")
+		case d.RemovedHost:
+			fmt.Println("  主机已不在新结果中")
+		}
+		if d.Note != "" {
+			fmt.Printf("  %s\n", d.Note)
+		}
+		for _, p := range d.Opened {
+			fmt.Printf("  + %s %s %s\n", p.key(), p.Service, p.Version)
+		}
+		for _, p := range d.Closed {
+			fmt.Printf("  - %s %s %s\n", p.key(), p.Service, p.Version)
+		}
+		for _, c := range d.Changed {
+			fmt.Printf("  ~ %s/%s %s %s -> %s %s\n", c.Port, c.Protocol, c.OldService, c.OldVersion, c.NewService, c.NewVersion)
+		}
+		if d.OSChanged {
+			fmt.Printf("  操作系统: %s -> %s\n", d.OldOS, d.NewOS)
+		}
+	}
+	fmt.Printf("\n新开放端口: %d  关闭端口: %d  服务变化: %d  主机离线: %d  操作系统变化: %d\n",
+		report.Summary.Opened, report.Summary.Closed, report.Summary.Changed, report.Summary.HostsDown, report.Summary.OSChanged)
+}
+
+// 差异报告Excel，按变化类型着色: 新开放红色、关闭绿色、服务变化黄色、操作系统变化蓝色
+func exportDiffExcel(report diffReport, filename string) error {
+	f := excelize.NewFile()
+	defer f.Close()
+
+	sheet := "差异"
+	f.SetSheetName("Sheet1", sheet)
+	headers := []string{"IP", "所属单位", "变化类型", "端口", "协议", "原服务", "原版本", "新服务", "新版本", "原操作系统", "新操作系统", "说明"}
+	for i, header := range headers {
+		cell, _ := excelize.CoordinatesToCellName(i+1, 1)
+		f.SetCellValue(sheet, cell, header)
+	}
+
+	fill := func(color string) int {
+		style, _ := f.NewStyle(&excelize.Style{
+			Fill:      excelize.Fill{Type: "pattern", Color: []string{color}, Pattern: 1},
+			Alignment: &excelize.Alignment{Vertical: "center", WrapText: true},
+		})
+		return style
+	}
+	styles := map[string]int{
+		"新开放":    fill("FFC7CE"),
+		"关闭":     fill("C6EFCE"),
+		"服务变化":   fill("FFEB9C"),
+		"操作系统变化": fill("DDEBF7"),
+		"新增主机":   fill("FFC7CE"),
+		"主机消失":   fill("EDEDED"),
+		"主机离线":   fill("EDEDED"),
+		"未比较":    fill("EDEDED"),
+	}
+
+	row := 2
+	write := func(kind string, values ...string) {
+		for i, v := range values {
+			cell, _ := excelize.CoordinatesToCellName(i+1, row)
+			f.SetCellValue(sheet, cell, v)
+		}
+		f.SetCellStyle(sheet, fmt.Sprintf("A%d", row), fmt.Sprintf("L%d", row), styles[kind])
+		row++
+	}
+
+	for _, d := range report.Hosts {
+		if d.HostDown {
+			write("主机离线", d.IP, d.Number, "主机离线", "", "", "", "", "", "", "", "", d.Note)
+			continue
+		}
+		if d.Note != "" {
+			write("未比较", d.IP, d.Number, "未比较", "", "", "", "", "", "", "", "", d.Note)
+			continue
+		}
+		if d.NewHost && len(d.Opened) == 0 {
+			write("新增主机", d.IP, d.Number, "新增主机")
+		}
+		if d.RemovedHost && len(d.Closed) == 0 {
+			write("主机消失", d.IP, d.Number, "主机消失")
+		}
+		for _, p := range d.Opened {
+			write("新开放", d.IP, d.Number, "新开放", p.Port, p.Protocol, "", "", p.Service, p.Version)
+		}
+		for _, p := range d.Closed {
+			write("关闭", d.IP, d.Number, "关闭", p.Port, p.Protocol, p.Service, p.Version)
+		}
+		for _, c := range d.Changed {
+			write("服务变化", d.IP, d.Number, "服务变化", c.Port, c.Protocol, c.OldService, c.OldVersion, c.NewService, c.NewVersion)
+		}
+		if d.OSChanged {
+			write("操作系统变化", d.IP, d.Number, "操作系统变化", "", "", "", "", "", "", d.OldOS, d.NewOS)
+		}
+	}
+
+	widths := []float64{15, 15, 12, 8, 8, 15, 25, 15, 25, 25, 25, 30}
+	for i, width := range widths {
+		col, _ := excelize.ColumnNumberToName(i + 1)
+		f.SetColWidth(sheet, col, col, width)
+	}
+	return f.SaveAs(filename)
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// 结果文件中的一行源数据及其扫描结果
+type excelRow struct {
+	info   ExcelInfo
+	result ScanResult
+}
+
+// 用 excelWriter 生成结果文件，再按 diff 的方式读回
+func writeResultRows(t *testing.T, name string, rows []excelRow) map[string]*hostSnapshot {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), name)
+	w, err := openExcelWriter(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range rows {
+		if _, err := w.Write(row.info.IP, row.result, row.info); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	hosts, err := loadResultExcel(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hosts
+}
+
+func writeResultExcel(t *testing.T, name string, results map[string]ScanResult) map[string]*hostSnapshot {
+	t.Helper()
+	var rows []excelRow
+	for _, ip := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+		if result, ok := results[ip]; ok {
+			rows = append(rows, excelRow{ExcelInfo{Number: "单位A", IP: ip}, result})
+		}
+	}
+	return writeResultRows(t, name, rows)
+}
+
+func TestDiffResultExcel(t *testing.T) {
+	web := []PortInfo{
+		{Port: "80", Protocol: "tcp", State: "open", Service: "http", Version: "nginx"},
+		{Port: "443", Protocol: "tcp", State: "open", Service: "https", Version: "nginx"},
+	}
+	oldHosts := writeResultExcel(t, "old.xlsx", map[string]ScanResult{
+		"10.0.0.1": {OS: []string{"Linux 5.X "}, Ports: web, HostState: hostUp},
+		"10.0.0.2": {OS: []string{"Linux 5.X"}, Ports: web, HostState: hostUp},
+		"10.0.0.3": {OS: []string{"Windows"}, Ports: web[:1], HostState: hostUp},
+	})
+	newHosts := writeResultExcel(t, "new.xlsx", map[string]ScanResult{
+		// 没有识别出操作系统，443 关闭
+		"10.0.0.1": {Ports: web[:1], HostState: hostUp},
+		// 主机离线
+		"10.0.0.2": {HostState: hostDown, HostReason: "no-response"},
+		"10.0.0.3": {OS: []string{"Linux 5.X"}, Ports: web[:1], HostState: hostUp},
+	})
+
+	report := diffSnapshots(oldHosts, newHosts)
+	got := make(map[string]hostDiff)
+	for _, d := range report.Hosts {
+		got[d.IP] = d
+	}
+
+	if d := got["10.0.0.1"]; d.OSChanged || d.HostDown || len(d.Closed) != 1 || d.Closed[0].Port != "443" {
+		t.Errorf("10.0.0.1: 应只报告443关闭，得到 %+v", d)
+	}
+	if d := got["10.0.0.2"]; !d.HostDown || len(d.Closed) != 0 || d.Note != "主机离线，未比较端口，原开放端口: 80/tcp 443/tcp" {
+		t.Errorf("10.0.0.2: 应报告主机离线，得到 %+v", d)
+	}
+	if d := got["10.0.0.3"]; !d.OSChanged || d.OldOS != "Windows" || d.NewOS != "Linux 5.X" {
+		t.Errorf("10.0.0.3: 应报告操作系统变化，得到 %+v", d)
+	}
+	want := diffSummary{Hosts: 3, Closed: 1, HostsDown: 1, OSChanged: 1}
+	if report.Summary != want {
+		t.Errorf("汇总为 %+v，应为 %+v", report.Summary, want)
+	}
+}
+
+func TestDiffHostBackOnline(t *testing.T) {
+	oldHosts := map[string]*hostSnapshot{
+		"10.0.0.1": {IP: "10.0.0.1", State: hostDown, Ports: map[string]portSnapshot{}},
+	}
+	newHosts := map[string]*hostSnapshot{
+		"10.0.0.1": {IP: "10.0.0.1", State: hostUp, Ports: map[string]portSnapshot{
+			"22/tcp": {Port: "22", Protocol: "tcp", State: "open", Service: "ssh"},
+		}},
+	}
+	report := diffSnapshots(oldHosts, newHosts)
+	if report.Summary.Opened != 1 || report.Summary.HostsDown != 0 {
+		t.Errorf("重新上线的主机应报告新开放端口，得到 %+v", report.Summary)
+	}
+}
+
+// 失败和没有扫描的行不能把原来开放的端口报告为关闭
+func TestDiffFailedAndSkippedRows(t *testing.T) {
+	web := []PortInfo{
+		{Port: "80", Protocol: "tcp", State: "open", Service: "http", Version: "nginx"},
+		{Port: "443", Protocol: "tcp", State: "open", Service: "https", Version: "nginx"},
+	}
+	var oldRows []excelRow
+	for _, ip := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4"} {
+		oldRows = append(oldRows, excelRow{ExcelInfo{Number: "单位A", IP: ip}, ScanResult{Ports: web, HostState: hostUp}})
+	}
+	oldHosts := writeResultRows(t, "old.xlsx", oldRows)
+
+	// 与 runBatch 写入失败的行相同
+	failed := ScanResult{OS: []string{"扫描失败: exit status 1"}, Ports: []PortInfo{}}
+	newHosts := writeResultRows(t, "new.xlsx", []excelRow{
+		{ExcelInfo{Number: "单位A", IP: "10.0.0.1"}, failed},
+		{ExcelInfo{Number: "单位A", IP: "10.0.0.2", OutOfScope: "不在授权范围内"}, ScanResult{}},
+		{ExcelInfo{Number: "单位A", IP: "10.0.0.3", PORT: "80"}, ScanResult{}},
+		{ExcelInfo{Number: "单位A", IP: "10.0.0.4"}, ScanResult{Ports: web, HostState: hostUp}},
+		// 其他单位的重复行不能覆盖前面已扫描的结果
+		{ExcelInfo{Number: "单位B", IP: "10.0.0.4", Duplicate: "与第4行相同"}, ScanResult{}},
+	})
+
+	if h := newHosts["10.0.0.1"]; h == nil || !h.Failed {
+		t.Errorf("10.0.0.1 应读为扫描失败，得到 %+v", h)
+	}
+	for _, ip := range []string{"10.0.0.2", "10.0.0.3"} {
+		if h := newHosts[ip]; h == nil || !h.Skipped {
+			t.Errorf("%s 应读为未扫描，得到 %+v", ip, h)
+		}
+	}
+	if h := newHosts["10.0.0.4"]; h == nil || h.Skipped || len(h.Ports) != 2 {
+		t.Errorf("10.0.0.4 应保留已扫描的结果，得到 %+v", h)
+	}
+
+	report := diffSnapshots(oldHosts, newHosts)
+	if report.Summary != (diffSummary{Hosts: 3}) {
+		t.Errorf("汇总为 %+v，应只有3个未比较的主机", report.Summary)
+	}
+	for _, d := range report.Hosts {
+		if d.Note == "" || len(d.Closed) > 0 || d.RemovedHost {
+			t.Errorf("%s 应只说明未比较端口，得到 %+v", d.IP, d)
+		}
+	}
+}
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// 导出格式的版本号，字段有不兼容的修改时递增
+const schemaVersion = "2"
+
+// 每行的处理状态
+const (
+	statusScanned     = "scanned"      // 扫描完成
+	statusFailed      = "failed"       // nmap执行失败
+	statusInterrupted = "interrupted"  // 扫描被中断，只有部分结果
+	statusNoIP        = "no_ip"        // 没有IP，未扫描
+	statusOutOfScope  = "out_of_scope" // 超出授权范围，未扫描
+	statusPortFilled  = "port_filled"  // 源文件端口列已填写，未扫描
+	statusDuplicate   = "duplicate"    // 与前面的行目标相同，未重复扫描
+)
+
+// 导出的单个主机记录，JSON/NDJSON/CSV共用
+//
+// schema_version 为 "2" 时的字段，字段有增减或改名时版本号递增:
+//
+//	row            源文件中的行序号(从0开始，展开网段后按主机计)
+//	number/name/domain/ip/source_port/remark  来自源文件的 所属单位/网站名称/网站地址/IP/端口/备注
+//	ip_source      IP来源，如 "DNS解析: www.example.com"
+//	status         scanned / failed / interrupted / no_ip / out_of_scope / port_filled / duplicate
+//	error          扫描失败或中断的原因，超出授权范围、目标无效或重复时为原因
+//	os             精确匹配的操作系统
+//	os_guesses     操作系统猜测，格式为 "名称 (准确率%)"
+//	os_matches     全部操作系统匹配及准确率
+//	ports          端口列表，见 portRecord，使用 -policy 时 findings 为端口命中的规则，
+//	               使用 -cve 时 cves/cvss 为匹配到的CVE和最高CVSS分数
+//	scan_start     开始扫描的时间(RFC3339)
+//	duration_sec   扫描耗时(秒)
+//	nmap_version/nmap_args  nmap版本和完整参数
+//	host_scripts   主机级别的NSE脚本输出，端口的脚本输出在端口的 scripts 中，
+//	               http-title/ssl-cert 另外提取为 http_title/ssl_cert
+//	host_state/host_reason  主机状态 up / down 及判断依据，未知时为空
+//	latency_ms     延迟(毫秒)
+//	mac/mac_vendor MAC地址和厂商，只有同一网段的主机才有
+//	rdns           反向DNS解析得到的主机名
+//	uptime_sec/last_boot  运行时间推测，需要 -O
+//	distance       网络距离(跳数)
+//	traceroute     路由跟踪，需要 --traceroute
+//	extra_ports    未列出的端口汇总，如 {"state":"filtered","count":1000}
+//	phases         分阶段扫描(-two-phase)时每个阶段的参数、耗时和开放端口数
+type hostRecord struct {
+	SchemaVersion string          `json:"schema_version"`
+	Row           int             `json:"row"`
+	Number        string          `json:"number"`
+	Name          string          `json:"name"`
+	Domain        string          `json:"domain"`
+	IP            string          `json:"ip"`
+	SourcePort    string          `json:"source_port"`
+	Remark        string          `json:"remark"`
+	IPSource      string          `json:"ip_source,omitempty"`
+	Status        string          `json:"status"`
+	Error         string          `json:"error,omitempty"`
+	OS            []string        `json:"os"`
+	OSGuesses     []string        `json:"os_guesses"`
+	OSMatches     []osMatchRecord `json:"os_matches"`
+	Ports         []portRecord    `json:"ports"`
+	ScanStart     *time.Time      `json:"scan_start,omitempty"`
+	DurationSec   float64         `json:"duration_sec"`
+	NmapVersion   string          `json:"nmap_version,omitempty"`
+	NmapArgs      string          `json:"nmap_args,omitempty"`
+	HostScripts   []ScriptOutput  `json:"host_scripts,omitempty"`
+	HostState     string          `json:"host_state,omitempty"`
+	HostReason    string          `json:"host_reason,omitempty"`
+	LatencyMS     float64         `json:"latency_ms,omitempty"`
+	MAC           string          `json:"mac,omitempty"`
+	MACVendor     string          `json:"mac_vendor,omitempty"`
+	RDNS          string          `json:"rdns,omitempty"`
+	UptimeSec     int64           `json:"uptime_sec,omitempty"`
+	LastBoot      string          `json:"last_boot,omitempty"`
+	Distance      int             `json:"distance,omitempty"`
+	Traceroute    []hopRecord     `json:"traceroute,omitempty"`
+	ExtraPorts    []extraPorts    `json:"extra_ports,omitempty"`
+	Phases        []phaseRecord   `json:"phases,omitempty"`
+}
+
+type phaseRecord struct {
+	Name        string  `json:"name"`
+	Args        string  `json:"args"`
+	DurationSec float64 `json:"duration_sec"`
+	OpenPorts   int     `json:"open_ports"`
+}
+
+type hopRecord struct {
+	TTL   int     `json:"ttl"`
+	IP    string  `json:"ip"`
+	Host  string  `json:"host,omitempty"`
+	RTTMS float64 `json:"rtt_ms"`
+}
+
+type extraPorts struct {
+	State string `json:"state"`
+	Count int    `json:"count"`
+}
+
+type osMatchRecord struct {
+	Name     string `json:"name"`
+	Accuracy int    `json:"accuracy"`
+}
+
+type portRecord struct {
+	Port           string         `json:"port"`
+	Protocol       string         `json:"protocol"`
+	State          string         `json:"state"`
+	Service        string         `json:"service"`
+	Version        string         `json:"version"`
+	Product        string         `json:"product,omitempty"`
+	ProductVersion string         `json:"product_version,omitempty"`
+	ExtraInfo      string         `json:"extra_info,omitempty"`
+	CPE            []string       `json:"cpe,omitempty"`
+	Findings       []finding      `json:"findings,omitempty"`
+	CVEs           []string       `json:"cves,omitempty"`
+	CVSS           float64        `json:"cvss,omitempty"`
+	HTTPTitle      string         `json:"http_title,omitempty"`
+	SSLCert        string         `json:"ssl_cert,omitempty"`
+	Scripts        []ScriptOutput `json:"scripts,omitempty"`
+}
+
+func newHostRecord(row int, info ExcelInfo, result ScanResult, status string, scanErr error, start time.Time, duration time.Duration) hostRecord {
+	rec := hostRecord{
+		SchemaVersion: schemaVersion,
+		Row:           row,
+		Number:        info.Number,
+		Name:          info.Name,
+		Domain:        info.Domain,
+		IP:            info.IP,
+		SourcePort:    info.PORT,
+		Remark:        info.REMARK,
+		IPSource:      info.IPSource,
+		Status:        status,
+		OS:            nonNil(result.OS),
+		OSGuesses:     nonNil(result.OSGuesses),
+		OSMatches:     make([]osMatchRecord, 0, len(result.OSMatches)),
+		Ports:         make([]portRecord, 0, len(result.Ports)),
+		DurationSec:   duration.Seconds(),
+		NmapVersion:   result.Meta.Version,
+		NmapArgs:      result.Meta.Args,
+		HostScripts:   result.HostScripts,
+		HostState:     result.HostState,
+		HostReason:    result.HostReason,
+		LatencyMS:     latencyMillis(result.Latency),
+		MAC:           result.MAC,
+		MACVendor:     result.MACVendor,
+		RDNS:          result.RDNS,
+		UptimeSec:     int64(result.Uptime / time.Second),
+		LastBoot:      result.LastBoot,
+		Distance:      result.Distance,
+	}
+	for _, h := range result.Hops {
+		rec.Traceroute = append(rec.Traceroute, hopRecord{TTL: h.TTL, IP: h.IPAddr, Host: h.Host, RTTMS: h.RTT})
+	}
+	for _, e := range result.ExtraPorts {
+		rec.ExtraPorts = append(rec.ExtraPorts, extraPorts{State: e.State, Count: e.Count})
+	}
+	for _, p := range result.Meta.Phases {
+		rec.Phases = append(rec.Phases, phaseRecord{Name: p.Name, Args: p.Args, DurationSec: p.Elapsed.Seconds(), OpenPorts: p.OpenPorts})
+	}
+	if scanErr != nil {
+		rec.Error = scanErr.Error()
+	}
+	if !start.IsZero() {
+		rec.ScanStart = &start
+	}
+	for _, m := range result.OSMatches {
+		rec.OSMatches = append(rec.OSMatches, osMatchRecord{Name: m.Name, Accuracy: m.Accuracy})
+	}
+	for _, p := range result.Ports {
+		rec.Ports = append(rec.Ports, portRecord{
+			Port:           p.Port,
+			Protocol:       p.Protocol,
+			State:          p.State,
+			Service:        p.Service,
+			Version:        p.Version,
+			Product:        p.Product,
+			ProductVersion: p.ProductVersion,
+			ExtraInfo:      p.ExtraInfo,
+			CPE:            p.CPE,
+			Findings:       p.Findings,
+			CVEs:           p.CVEs,
+			CVSS:           p.CVSS,
+			HTTPTitle:      p.HTTPTitle,
+			SSLCert:        p.SSLCert,
+			Scripts:        p.Scripts,
+		})
+	}
+	return rec
+}
+
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
+
+// 结果输出，每处理完一行调用一次Write
+type resultWriter interface {
+	Write(rec hostRecord) error
+	Close() error
+}
+
+// 根据 -o 指定的格式(逗号分隔)创建输出，文件名为 base 加对应扩展名
+func newResultWriters(formats string, base string) ([]resultWriter, error) {
+	var writers []resultWriter
+	for _, format := range strings.Split(formats, ",") {
+		format = strings.ToLower(strings.TrimSpace(format))
+		if format == "" {
+			continue
+		}
+
+		var w resultWriter
+		var err error
+		switch format {
+		case "json":
+			w, err = newJSONWriter(base + ".json")
+		case "ndjson":
+			w, err = newNDJSONWriter(base + ".ndjson")
+		case "csv":
+			w, err = newCSVWriter(base + ".csv")
+		default:
+			err = fmt.Errorf("不支持的输出格式: %s", format)
+		}
+		if err != nil {
+			for _, opened := range writers {
+				opened.Close()
+			}
+			return nil, err
+		}
+		writers = append(writers, w)
+	}
+	return writers, nil
+}
+
+// JSON输出，所有记录在Close时一次写入
+type jsonWriter struct {
+	filename string
+	hosts    []hostRecord
+}
+
+func newJSONWriter(filename string) (*jsonWriter, error) {
+	return &jsonWriter{filename: filename, hosts: make([]hostRecord, 0)}, nil
+}
+
+func (w *jsonWriter) Write(rec hostRecord) error {
+	w.hosts = append(w.hosts, rec)
+	return nil
+}
+
+func (w *jsonWriter) Close() error {
+	doc := struct {
+		SchemaVersion string       `json:"schema_version"`
+		GeneratedAt   time.Time    `json:"generated_at"`
+		Hosts         []hostRecord `json:"hosts"`
+	}{schemaVersion, time.Now(), w.hosts}
+
+	data, err := json.MarshalIndent(doc, "", "    ")
+	if err != nil {
+		return fmt.Errorf("转换JSON失败: %v", err)
+	}
+	if err := os.WriteFile(w.filename, data, 0644); err != nil {
+		return fmt.Errorf("写入JSON文件失败: %v", err)
+	}
+	return nil
+}
+
+// NDJSON输出，每个主机一行，扫描过程中实时写入
+type ndjsonWriter struct {
+	file *os.File
+	buf  *bufio.Writer
+}
+
+func newNDJSONWriter(filename string) (*ndjsonWriter, error) {
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, fmt.Errorf("创建NDJSON文件失败: %v", err)
+	}
+	return &ndjsonWriter{file: file, buf: bufio.NewWriter(file)}, nil
+}
+
+func (w *ndjsonWriter) Write(rec hostRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("转换JSON失败: %v", err)
+	}
+	w.buf.Write(data)
+	w.buf.WriteByte('\n')
+	return w.buf.Flush()
+}
+
+func (w *ndjsonWriter) Close() error {
+	if err := w.buf.Flush(); err != nil {
+		w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
+
+// CSV输出，与Excel一样每个端口一行，没有端口的主机输出一行
+type csvWriter struct {
+	file *os.File
+	csv  *csv.Writer
+}
+
+var csvHeaders = []string{
+	"schema_version", "row", "number", "name", "domain", "ip", "source_port", "remark", "ip_source",
+	"status", "error", "os", "os_guesses", "port", "protocol", "state", "service", "version",
+	"cpe", "scan_start", "duration_sec", "severity", "findings", "cves", "cvss", "http_title", "ssl_cert",
+	"host_state", "latency_ms", "mac", "mac_vendor", "rdns", "uptime_sec", "distance",
+}
+
+func newCSVWriter(filename string) (*csvWriter, error) {
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, fmt.Errorf("创建CSV文件失败: %v", err)
+	}
+	w := &csvWriter{file: file, csv: csv.NewWriter(file)}
+
+	// 写入BOM，Excel打开时中文不乱码
+	file.WriteString("\xEF\xBB\xBF")
+	if err := w.csv.Write(csvHeaders); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("写入CSV文件失败: %v", err)
+	}
+	return w, nil
+}
+
+func (w *csvWriter) Write(rec hostRecord) error {
+	scanStart := ""
+	if rec.ScanStart != nil {
+		scanStart = rec.ScanStart.Format(time.RFC3339)
+	}
+	base := []string{
+		rec.SchemaVersion, fmt.Sprint(rec.Row), rec.Number, rec.Name, rec.Domain, rec.IP, rec.SourcePort,
+		rec.Remark, rec.IPSource, rec.Status, rec.Error,
+		strings.Join(rec.OS, "; "), strings.Join(rec.OSGuesses, "; "),
+	}
+	tail := []string{scanStart, fmt.Sprintf("%.1f", rec.DurationSec)}
+	hostInfo := []string{rec.HostState, "", rec.MAC, rec.MACVendor, rec.RDNS, "", ""}
+	if rec.LatencyMS > 0 {
+		hostInfo[1] = fmt.Sprint(rec.LatencyMS)
+	}
+	if rec.UptimeSec > 0 {
+		hostInfo[5] = fmt.Sprint(rec.UptimeSec)
+	}
+	if rec.Distance > 0 {
+		hostInfo[6] = fmt.Sprint(rec.Distance)
+	}
+
+	ports := rec.Ports
+	if len(ports) == 0 {
+		ports = []portRecord{{}}
+	}
+	for _, p := range ports {
+		line := append(append([]string{}, base...),
+			p.Port, p.Protocol, p.State, p.Service, p.Version, strings.Join(p.CPE, " "))
+		var texts []string
+		for _, f := range p.Findings {
+			texts = append(texts, f.Finding)
+		}
+		cvss := ""
+		if len(p.CVEs) > 0 {
+			cvss = fmt.Sprint(p.CVSS)
+		}
+		line = append(append(line, tail...), highestSeverity(p.Findings), strings.Join(texts, "; "),
+			strings.Join(p.CVEs, " "), cvss, p.HTTPTitle, p.SSLCert)
+		line = append(line, hostInfo...)
+		if err := w.csv.Write(line); err != nil {
+			return fmt.Errorf("写入CSV文件失败: %v", err)
+		}
+	}
+	w.csv.Flush()
+	return w.csv.Error()
+}
+
+func (w *csvWriter) Close() error {
+	w.csv.Flush()
+	if err := w.csv.Error(); err != nil {
+		w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	nmapscan "github.com/helar52-xl/batch_scan_ip_base_nmap/nmap_scan"
+)
+
+// history 子命令: 查询扫描历史，或将某次运行的结果重新导出
+func runHistory(args []string) {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	dbPath := fs.String("db", "scan_history.db", "扫描历史数据库路径")
+	ip := fs.String("ip", "", "按IP查询")
+	port := fs.String("port", "", "按端口查询")
+	service := fs.String("service", "", "按服务或应用名称查询(模糊匹配)")
+	org := fs.String("org", "", "按所属单位查询(模糊匹配)")
+	listRuns := fs.Bool("runs", false, "列出所有运行记录")
+	runID := fs.Int64("run", 0, "导出指定运行的结果，配合 -e/-o/-html 使用")
+	excelOutput := fs.String("e", "", "导出到Excel文件")
+	outputFormats := fs.String("o", "", "导出格式，可选 json、ndjson、csv，多个用逗号分隔")
+	outputBase := fs.String("out", "history_result", "-o 输出文件的路径(不含扩展名)")
+	htmlOutput := fs.String("html", "", "导出HTML报告")
+	fs.Parse(args)
+
+	store, err := openSQLiteStore(*dbPath)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return
+	}
+	defer store.Close()
+
+	switch {
+	case *listRuns:
+		printRuns(store)
+	case *runID > 0:
+		exportRun(store, *runID, *excelOutput, *outputFormats, *outputBase, *htmlOutput)
+	default:
+		printHistory(store, historyQuery{IP: *ip, Port: *port, Service: *service, Org: *org})
+	}
+}
+
+func printRuns(store resultStore) {
+	runs, err := store.Runs()
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\t开始时间\t结束时间\t主机数\t源文件\tnmap参数")
+	for _, run := range runs {
+		finished := "未完成"
+		if !run.FinishedAt.IsZero() {
+			finished = run.FinishedAt.Local().Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%d\t%s\t%s\n", run.ID,
+			run.StartedAt.Local().Format("2006-01-02 15:04:05"), finished, run.Hosts, run.Source, run.NmapArgs)
+	}
+	tw.Flush()
+}
+
+func printHistory(store resultStore, q historyQuery) {
+	rows, err := store.Query(q)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return
+	}
+	if len(rows) == 0 {
+		fmt.Println("没有匹配的记录")
+		return
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "IP\t所属单位\t端口\t状态\t协议\t应用\t首次发现\t最后发现\t次数")
+	for _, r := range rows {
+		fmt.Fprintf(tw, "%s\t%s\t%s/%s\t%s\t%s\t%s\t%s\t%s\t%d\n", r.IP, r.Number, r.Port, r.Protocol, r.State,
+			r.Service, r.Version, r.FirstSeen.Local().Format("2006-01-02 15:04"),
+			r.LastSeen.Local().Format("2006-01-02 15:04"), r.Runs)
+	}
+	tw.Flush()
+}
+
+// 从历史存储中读取某次运行的结果并导出
+func exportRun(store resultStore, runID int64, excelOutput string, formats string, base string, htmlOutput string) {
+	hosts, err := store.Hosts(runID)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return
+	}
+	if len(hosts) == 0 {
+		fmt.Printf("运行 %d 没有记录\n", runID)
+		return
+	}
+
+	if excelOutput != "" {
+		excel, err := openExcelWriter(excelOutput)
+		if err != nil {
+			fmt.Printf("创建Excel文件时出错: %v\n", err)
+			return
+		}
+		for _, rec := range hosts {
+			info, result := rec.toScanResult()
+			if _, err := excel.Write(info.IP, result, info); err != nil {
+				fmt.Printf("写入 %s 的扫描结果时出错: %v\n", info.IP, err)
+			}
+		}
+		if err := excel.Close(); err != nil {
+			fmt.Printf("%v\n", err)
+			return
+		}
+		fmt.Printf("已导出到Excel文件: %s\n", excelOutput)
+	}
+
+	writers, err := newResultWriters(formats, base)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return
+	}
+	if htmlOutput != "" {
+		writers = append(writers, &htmlWriter{filename: htmlOutput})
+	}
+	for _, w := range writers {
+		for _, rec := range hosts {
+			if err := w.Write(rec); err != nil {
+				fmt.Printf("%v\n", err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			fmt.Printf("%v\n", err)
+		}
+	}
+}
+
+// 将导出记录还原为源信息和扫描结果，用于重新生成Excel
+func (rec hostRecord) toScanResult() (ExcelInfo, ScanResult) {
+	info := ExcelInfo{
+		Number:   rec.Number,
+		Name:     rec.Name,
+		Domain:   rec.Domain,
+		IP:       rec.IP,
+		PORT:     rec.SourcePort,
+		REMARK:   rec.Remark,
+		IPSource: rec.IPSource,
+	}
+	result := ScanResult{
+		OS:          rec.OS,
+		OSGuesses:   rec.OSGuesses,
+		HostScripts: rec.HostScripts,
+		Ports:       make([]PortInfo, 0, len(rec.Ports)),
+		HostState:   rec.HostState,
+		HostReason:  rec.HostReason,
+		Latency:     time.Duration(rec.LatencyMS * float64(time.Millisecond)),
+		MAC:         rec.MAC,
+		MACVendor:   rec.MACVendor,
+		RDNS:        rec.RDNS,
+		Uptime:      time.Duration(rec.UptimeSec) * time.Second,
+		LastBoot:    rec.LastBoot,
+		Distance:    rec.Distance,
+	}
+	for _, h := range rec.Traceroute {
+		result.Hops = append(result.Hops, nmapscan.Hop{TTL: h.TTL, IPAddr: h.IP, Host: h.Host, RTT: h.RTTMS})
+	}
+	for _, e := range rec.ExtraPorts {
+		result.ExtraPorts = append(result.ExtraPorts, nmapscan.ExtraPorts{State: e.State, Count: e.Count})
+	}
+	for _, p := range rec.Phases {
+		result.Meta.Phases = append(result.Meta.Phases, nmapscan.Phase{Name: p.Name, Args: p.Args,
+			Elapsed: time.Duration(p.DurationSec * float64(time.Second)), OpenPorts: p.OpenPorts})
+	}
+	for _, m := range rec.OSMatches {
+		result.OSMatches = append(result.OSMatches, nmapscan.OSMatch{Name: m.Name, Accuracy: m.Accuracy})
+	}
+	for _, p := range rec.Ports {
+		result.Ports = append(result.Ports, PortInfo{
+			Port:           p.Port,
+			Protocol:       p.Protocol,
+			Service:        p.Service,
+			Version:        p.Version,
+			State:          p.State,
+			Product:        p.Product,
+			ProductVersion: p.ProductVersion,
+			ExtraInfo:      p.ExtraInfo,
+			CPE:            p.CPE,
+			Findings:       p.Findings,
+			CVEs:           p.CVEs,
+			CVSS:           p.CVSS,
+			HTTPTitle:      p.HTTPTitle,
+			SSLCert:        p.SSLCert,
+			Scripts:        p.Scripts,
+		})
+	}
+	return info, result
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	nmapscan "github.com/helar52-xl/batch_scan_ip_base_nmap/nmap_scan"
+)
+
+// 主机状态，空表示未知(如扫描失败或被中断)
+const (
+	hostUp   = "up"
+	hostDown = "down"
+)
+
+// 从nmap XML中取出主机级别的信息
+func fillHostInfo(result *ScanResult, host nmapscan.Host) {
+	result.HostState = host.Status.State
+	result.HostReason = host.Status.Reason
+	result.MAC, result.MACVendor = host.MAC()
+	result.RDNS = host.PTR()
+	result.ExtraPorts = host.ExtraPorts
+	if host.Times != nil && host.Times.SRTT > 0 {
+		result.Latency = time.Duration(host.Times.SRTT) * time.Microsecond
+	}
+	if host.Uptime != nil {
+		result.Uptime = time.Duration(host.Uptime.Seconds) * time.Second
+		result.LastBoot = host.Uptime.LastBoot
+	}
+	if host.Distance != nil {
+		result.Distance = host.Distance.Value
+	}
+	if host.Trace != nil {
+		result.Hops = host.Trace.Hops
+	}
+}
+
+// 没有端口行时写入状态列的说明，区分主机离线和主机在线但没有开放端口
+func hostStateText(result ScanResult) string {
+	switch result.HostState {
+	case hostDown:
+		if result.HostReason != "" {
+			return fmt.Sprintf("主机离线(%s)", result.HostReason)
+		}
+		return "主机离线"
+	case hostUp:
+		var extra []string
+		for _, e := range result.ExtraPorts {
+			extra = append(extra, fmt.Sprintf("%d个%s", e.Count, e.State))
+		}
+		if len(extra) > 0 {
+			return fmt.Sprintf("无开放端口(%s)", strings.Join(extra, ", "))
+		}
+		return "无开放端口"
+	}
+	return ""
+}
+
+// 主机状态列，如 "up (echo-reply)"
+func hostStateCell(result ScanResult) string {
+	if result.HostReason == "" {
+		return result.HostState
+	}
+	return fmt.Sprintf("%s (%s)", result.HostState, result.HostReason)
+}
+
+// 延迟，单位毫秒，保留两位小数
+func latencyMillis(d time.Duration) float64 {
+	return math.Round(float64(d)/float64(time.Millisecond)*100) / 100
+}
+
+// 运行时间，如 "12天3小时 (上次启动 Mon Jan  1 00:00:00 2024)"
+func uptimeText(result ScanResult) string {
+	if result.Uptime <= 0 {
+		return ""
+	}
+	days := int(result.Uptime / (24 * time.Hour))
+	hours := int(result.Uptime % (24 * time.Hour) / time.Hour)
+	text := fmt.Sprintf("%d天%d小时", days, hours)
+	if result.LastBoot != "" {
+		text += fmt.Sprintf(" (上次启动 %s)", result.LastBoot)
+	}
+	return text
+}
+
+// 路由跟踪，每跳一行，如 "1 10.0.0.1 0.52ms"
+func hopsText(hops []nmapscan.Hop) string {
+	var lines []string
+	for _, h := range hops {
+		addr := h.IPAddr
+		if h.Host != "" {
+			addr = fmt.Sprintf("%s (%s)", h.Host, h.IPAddr)
+		}
+		if addr == "" {
+			addr = "*"
+		}
+		lines = append(lines, fmt.Sprintf("%d %s %.2fms", h.TTL, addr, h.RTT))
+	}
+	return strings.Join(lines, "\n")
+}
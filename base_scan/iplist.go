@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	nmapscan "github.com/helar52-xl/batch_scan_ip_base_nmap/nmap_scan"
+)
+
+// 解析IP列表文件中的一行，格式为 目标[<Tab>名称[<Tab>备注]]。
+// 名称和备注用Tab分隔，目标中的逗号(如 10.1.2.1,3)保持原样
+func parseIPLine(line string) (ExcelInfo, bool) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ExcelInfo{}, false
+	}
+
+	fields := strings.SplitN(line, "\t", 3)
+	info := ExcelInfo{IP: strings.TrimSpace(fields[0])}
+	if len(fields) >= 2 {
+		info.Name = strings.TrimSpace(fields[1])
+	}
+	if len(fields) >= 3 {
+		info.REMARK = strings.TrimSpace(fields[2])
+	}
+	return info, info.IP != ""
+}
+
+// 从文件读取IP列表，每行一个IP，可附带名称和备注
+func readIPFile(filename string) ([]ExcelInfo, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("无法打开文件: %v", err)
+	}
+	defer file.Close()
+
+	var infos []ExcelInfo
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if info, ok := parseIPLine(scanner.Text()); ok {
+			infos = append(infos, info)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取文件失败: %v", err)
+	}
+	return infos, nil
+}
+
+// 解析命令行中用逗号分隔的IP列表，nmap八位组写法(如 10.1.2.1,3)不会被拆开
+func parseIPList(list string) []ExcelInfo {
+	var infos []ExcelInfo
+	for _, ip := range nmapscan.SplitTargets(list) {
+		infos = append(infos, ExcelInfo{IP: ip})
+	}
+	return infos
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	nmapscan "github.com/helar52-xl/batch_scan_ip_base_nmap/nmap_scan"
+)
+
+// 分阶段扫描的阶段名称，对应导出中 phases 的 name
+const (
+	phaseDiscovery = "discovery"
+	phaseDetection = "detection"
+)
+
+var phaseNames = map[string]string{
+	phaseDiscovery: "端口发现",
+	phaseDetection: "服务识别",
+}
+
+// 分阶段扫描：先用 discoverOpts 快速找出开放的端口，再只对这些TCP端口执行
+// Scan 传入的参数(-sV -O 等)，两次的结果合并为一个主机
+type twoPhaseScanner struct {
+	discover     nmapscan.Scanner
+	discoverOpts nmapscan.Options
+	detect       nmapscan.Scanner
+}
+
+func (s *twoPhaseScanner) Scan(ctx context.Context, target string, opts nmapscan.Options) (*nmapscan.Run, error) {
+	start := time.Now()
+	first, err := s.discover.Scan(ctx, target, s.discoverOpts)
+	discovery := nmapscan.Phase{Name: phaseDiscovery, Args: strings.Join(s.discoverOpts.Args, " "), Elapsed: time.Since(start)}
+	if err != nil {
+		if first != nil {
+			first.Phases = []nmapscan.Phase{discovery}
+		}
+		return first, fmt.Errorf("端口发现失败: %w", err)
+	}
+
+	tcp := openTCPPorts(first)
+	if len(first.Hosts) > 0 {
+		for _, p := range first.Hosts[0].Ports {
+			if p.State.State == "open" {
+				discovery.OpenPorts++
+			}
+		}
+	}
+	first.Phases = []nmapscan.Phase{discovery}
+	// 没有开放的TCP端口或主机离线时不需要第二阶段
+	if len(tcp) == 0 {
+		return first, nil
+	}
+
+	detectOpts := nmapscan.Options{Args: detectionArgs(opts.Args, tcp)}
+	start = time.Now()
+	second, err := s.detect.Scan(ctx, target, detectOpts)
+	detection := nmapscan.Phase{Name: phaseDetection, Args: strings.Join(detectOpts.Args, " "), Elapsed: time.Since(start)}
+	if err != nil {
+		err = fmt.Errorf("服务识别失败: %w", err)
+	}
+	if second == nil || len(second.Hosts) == 0 {
+		// 第二阶段没有结果时保留第一阶段发现的端口
+		first.Phases = append(first.Phases, detection)
+		return first, err
+	}
+
+	merged := mergePhases(first, second)
+	for _, p := range merged.Hosts[0].Ports {
+		if p.State.State == "open" {
+			detection.OpenPorts++
+		}
+	}
+	merged.Phases = []nmapscan.Phase{discovery, detection}
+	return merged, err
+}
+
+// 第一阶段结果中开放的TCP端口
+func openTCPPorts(run *nmapscan.Run) []int {
+	var ports []int
+	if len(run.Hosts) == 0 || !run.Hosts[0].Up() {
+		return ports
+	}
+	for _, p := range run.Hosts[0].Ports {
+		if p.Protocol == "tcp" && p.State.State == "open" {
+			ports = append(ports, p.PortID)
+		}
+	}
+	return ports
+}
+
+// 选择端口的长选项，值可以用"="连接或作为下一个参数
+var portOptions = map[string]bool{"--top-ports": true, "--port-ratio": true, "--exclude-ports": true}
+
+// 将参数分为选择端口的选项(-p、-F、--top-ports 等，包括它们的值)和其余参数
+func splitPortArgs(args []string) (ports, rest []string) {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		name, _, hasValue := strings.Cut(arg, "=")
+		// nmap 的长选项也可以只写一个"-"
+		if !strings.HasPrefix(name, "--") && portOptions["-"+name] {
+			name = "-" + name
+		}
+		switch {
+		case (portOptions[name] && !hasValue) || arg == "-p":
+			ports = append(ports, arg)
+			if i+1 < len(args) {
+				i++
+				ports = append(ports, args[i])
+			}
+		case portOptions[name], strings.HasPrefix(arg, "-p") && len(arg) > 2, arg == "-F":
+			ports = append(ports, arg)
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	return ports, rest
+}
+
+// 第一阶段的参数：-a 中指定了端口范围时改用该范围，否则使用端口发现参数自己的端口选项
+func discoveryArgs(discover, args []string) []string {
+	ports, _ := splitPortArgs(args)
+	if len(ports) == 0 {
+		return discover
+	}
+	_, rest := splitPortArgs(discover)
+	return append(rest, ports...)
+}
+
+// 第二阶段的参数：去掉原有的端口选项，改为只扫描发现的TCP端口。
+// UDP端口的结果取自第一阶段，去掉 -sU；第一阶段已确认主机在线，加上 -Pn 跳过主机发现
+func detectionArgs(args []string, ports []int) []string {
+	var out []string
+	_, rest := splitPortArgs(args)
+	for _, arg := range rest {
+		if isScanType(arg) && strings.Contains(arg, "U") {
+			// -sU 或与其他扫描类型合写的 -sSU
+			if rest := strings.ReplaceAll(arg[2:], "U", ""); rest != "" {
+				out = append(out, "-s"+rest)
+			}
+			continue
+		}
+		out = append(out, arg)
+	}
+	if !containsArg(out, "-Pn") {
+		out = append(out, "-Pn")
+	}
+	list := make([]string, len(ports))
+	for i, p := range ports {
+		list[i] = strconv.Itoa(p)
+	}
+	return append(out, "-p", strings.Join(list, ","))
+}
+
+// 扫描类型选项，如 -sS、-sU、-sSU，不包括 -script 等单"-"的长选项
+func isScanType(arg string) bool {
+	if !strings.HasPrefix(arg, "-s") || len(arg) == 2 {
+		return false
+	}
+	for _, c := range arg[2:] {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+func containsArg(args []string, name string) bool {
+	for _, a := range args {
+		if a == name {
+			return true
+		}
+	}
+	return false
+}
+
+// 以第二阶段的结果为准，补上只在第一阶段出现的端口(如UDP端口)和端口汇总
+func mergePhases(first, second *nmapscan.Run) *nmapscan.Run {
+	merged := *second
+	merged.Start = first.Start
+	merged.RunStats.Finished.Elapsed = first.RunStats.Finished.Elapsed + second.RunStats.Finished.Elapsed
+	merged.Hosts = append([]nmapscan.Host{}, second.Hosts...)
+	host := &merged.Hosts[0]
+	if len(first.Hosts) == 0 {
+		return &merged
+	}
+	firstHost := first.Hosts[0]
+
+	seen := make(map[string]bool)
+	for _, p := range host.Ports {
+		seen[p.Protocol+"/"+p.ID()] = true
+	}
+	ports := append([]nmapscan.Port{}, host.Ports...)
+	for _, p := range firstHost.Ports {
+		if !seen[p.Protocol+"/"+p.ID()] {
+			ports = append(ports, p)
+		}
+	}
+	sort.SliceStable(ports, func(i, j int) bool {
+		if ports[i].Protocol != ports[j].Protocol {
+			return ports[i].Protocol < ports[j].Protocol
+		}
+		return ports[i].PortID < ports[j].PortID
+	})
+	host.Ports = ports
+	// 第二阶段只扫描了开放的端口，其余端口的汇总来自第一阶段
+	host.ExtraPorts = firstHost.ExtraPorts
+	if mac, _ := host.MAC(); mac == "" {
+		for _, a := range firstHost.Addresses {
+			if a.AddrType == "mac" {
+				host.Addresses = append(append([]nmapscan.Address{}, host.Addresses...), a)
+			}
+		}
+	}
+	return &merged
+}
+
+// 各阶段耗时，如 "端口发现 12.3s (5个开放端口), 服务识别 40.1s"
+func phasesText(phases []nmapscan.Phase) string {
+	var parts []string
+	for _, p := range phases {
+		text := fmt.Sprintf("%s %.1fs", phaseNames[p.Name], p.Elapsed.Seconds())
+		if p.Name == phaseDiscovery {
+			text += fmt.Sprintf(" (%d个开放端口)", p.OpenPorts)
+		}
+		parts = append(parts, text)
+	}
+	return strings.Join(parts, ", ")
+}
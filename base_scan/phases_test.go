@@ -0,0 +1,53 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiscoveryArgs(t *testing.T) {
+	discover := strings.Fields(defaultDiscoverArgs)
+	tests := []struct {
+		args string
+		want string
+	}{
+		// -a 中没有端口选项时使用端口发现参数的 -p 1-65535
+		{"-sV -O", defaultDiscoverArgs},
+		{"-sV -O -p 1-1000", "-Pn -n -T4 --min-rate 5000 --max-retries 2 -p 1-1000"},
+		{"-sV -p80,443", "-Pn -n -T4 --min-rate 5000 --max-retries 2 -p80,443"},
+		{"-sV --top-ports 100 --exclude-ports=25", "-Pn -n -T4 --min-rate 5000 --max-retries 2 --top-ports 100 --exclude-ports=25"},
+		{"-sV -F", "-Pn -n -T4 --min-rate 5000 --max-retries 2 -F"},
+	}
+	for _, tt := range tests {
+		got := discoveryArgs(discover, strings.Fields(tt.args))
+		if want := strings.Fields(tt.want); !reflect.DeepEqual(got, want) {
+			t.Errorf("discoveryArgs(%q) = %q，应为 %q", tt.args, got, want)
+		}
+	}
+}
+
+func TestDetectionArgs(t *testing.T) {
+	tests := []struct {
+		args string
+		want string
+	}{
+		{"-sV -O", "-sV -O -Pn -p 22,80"},
+		{"-sV -p 1-65535", "-sV -Pn -p 22,80"},
+		{"-sV -p- -Pn", "-sV -Pn -p 22,80"},
+		{"-sV -F", "-sV -Pn -p 22,80"},
+		{"-sV --top-ports 100 --exclude-ports 25", "-sV -Pn -p 22,80"},
+		{"-sV --top-ports=100 --exclude-ports=25 --port-ratio=0.1", "-sV -Pn -p 22,80"},
+		{"-sV -top-ports 100 -exclude-ports=25", "-sV -Pn -p 22,80"},
+		{"-sV --script=http-title --host-timeout=5m", "-sV --script=http-title --host-timeout=5m -Pn -p 22,80"},
+		{"-sV -sU -p T:1-1000,U:53,161", "-sV -Pn -p 22,80"},
+		{"-sSU -sV --top-ports 100", "-sS -sV -Pn -p 22,80"},
+		{"-sV -script=broadcast-upnp-info,UPnP", "-sV -script=broadcast-upnp-info,UPnP -Pn -p 22,80"},
+	}
+	for _, tt := range tests {
+		got := detectionArgs(strings.Fields(tt.args), []int{22, 80})
+		if want := strings.Fields(tt.want); !reflect.DeepEqual(got, want) {
+			t.Errorf("detectionArgs(%q) = %q，应为 %q", tt.args, got, want)
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	nmapscan "github.com/helar52-xl/batch_scan_ip_base_nmap/nmap_scan"
+)
+
+// 扫描计划中每行的处理方式，除 planScan 外为 classifyRow 给出的 status，目标无效的行为 failed
+const planScan = "scan"
+
+var planLabels = map[string]string{
+	planScan:         "[扫描]",
+	statusNoIP:       "[跳过]",
+	statusFailed:     "[无效]",
+	statusOutOfScope: "[拒绝]",
+	statusPortFilled: "[已有端口]",
+	statusDuplicate:  "[重复]",
+}
+
+// 扫描计划中的一行，row为展开后的行序号(与导出的 row 相同)
+type planRow struct {
+	row     int
+	info    ExcelInfo
+	action  string
+	reason  string
+	command int // commands中的序号，不扫描时为-1
+}
+
+// 一次nmap(或内置扫描)进程
+type planCommand struct {
+	lines   []string // 分阶段扫描时有两条
+	targets []string
+	worst   time.Duration
+}
+
+// -plan 的结果：每行是否扫描、执行的命令和耗时估算
+type scanPlan struct {
+	rows        []planRow
+	commands    []planCommand
+	scanner     string
+	hosts       int
+	skipped     map[string]int
+	ports       int
+	portsText   string
+	hostWorst   time.Duration // 0 表示没有上限
+	worstText   string
+	concurrency int
+	total       time.Duration
+}
+
+// 按 runScans 的分批方式生成扫描计划
+func newScanPlan(infos []ExcelInfo, scanner nmapscan.Scanner, opts nmapscan.Options, concurrency, batchSize int) *scanPlan {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	if _, ok := scanner.(nmapscan.BatchScanner); !ok || batchSize < 1 {
+		batchSize = 1
+	}
+	p := &scanPlan{scanner: scannerName(scanner), skipped: make(map[string]int), concurrency: concurrency}
+	p.hostWorst, p.worstText = hostWorst(scanner, opts)
+	p.ports, p.portsText = hostPorts(scanner, opts)
+
+	for start := 0; start < len(infos); start += batchSize {
+		end := min(start+batchSize, len(infos))
+		var targets []string
+		for i := start; i < end; i++ {
+			row := planRow{row: i, info: infos[i], action: planScan, command: -1}
+			if status, reason := classifyRow(infos[i]); status != statusScanned {
+				row.action, row.reason = status, reason
+			} else {
+				row.command = len(p.commands)
+				targets = append(targets, infos[i].IP)
+				p.hosts++
+			}
+			if row.action != planScan {
+				p.skipped[row.action]++
+			}
+			p.rows = append(p.rows, row)
+		}
+		if len(targets) == 0 {
+			continue
+		}
+		// 批量扫描时按批内主机依次超时计算，是上限
+		cmd := planCommand{
+			lines:   planCommandLines(scanner, opts, targets, end-start > 1),
+			targets: targets,
+			worst:   p.hostWorst * time.Duration(len(targets)),
+		}
+		p.commands = append(p.commands, cmd)
+	}
+
+	// 与worker一样，每个进程交给最先空闲的worker
+	if p.hostWorst > 0 {
+		workers := make([]time.Duration, concurrency)
+		for _, cmd := range p.commands {
+			next := 0
+			for w := range workers {
+				if workers[w] < workers[next] {
+					next = w
+				}
+			}
+			workers[next] += cmd.worst
+			p.total = max(p.total, workers[next])
+		}
+	}
+	return p
+}
+
+func scannerName(scanner nmapscan.Scanner) string {
+	switch s := scanner.(type) {
+	case *twoPhaseScanner:
+		return fmt.Sprintf("分阶段扫描(%s端口发现 + %s服务识别)", scannerName(s.discover), scannerName(s.detect))
+	case *nmapscan.ConnectScanner:
+		return "内置扫描"
+	case *nmapscan.ReplayScanner:
+		return "回放(不执行nmap)"
+	}
+	return "nmap"
+}
+
+// 扫描这些目标时执行的命令行。batch为true时与 ExecScanner.ScanBatch 一样通过 -iL 传入
+func planCommandLines(scanner nmapscan.Scanner, opts nmapscan.Options, targets []string, batch bool) []string {
+	switch s := scanner.(type) {
+	case *twoPhaseScanner:
+		detect := detectionArgs(opts.Args, nil)
+		detect[len(detect)-1] = "<发现的端口>"
+		lines := planCommandLines(s.discover, s.discoverOpts, targets, false)
+		return append(lines, planCommandLines(s.detect, nmapscan.Options{Args: detect}, targets, false)...)
+	case *nmapscan.ConnectScanner:
+		return []string{quoteArgs(append(append([]string{"connect"}, opts.Args...), targets...))}
+	}
+
+	path := "nmap"
+	if s, ok := scanner.(*nmapscan.ExecScanner); ok && s.Path != "" {
+		path = s.Path
+	}
+	args := append(append([]string{path}, opts.Args...), "-oX", "-")
+	if batch {
+		args = append(args, "-iL", fmt.Sprintf("<%d个目标>", len(targets)))
+	} else {
+		args = append(args, targets...)
+	}
+	return []string{quoteArgs(args)}
+}
+
+func quoteArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		if a == "" || strings.ContainsAny(a, " \t\"'") {
+			a = strconv.Quote(a)
+		}
+		quoted[i] = a
+	}
+	return strings.Join(quoted, " ")
+}
+
+// 每个主机最长的耗时及说明，没有上限时返回0
+func hostWorst(scanner nmapscan.Scanner, opts nmapscan.Options) (time.Duration, string) {
+	switch s := scanner.(type) {
+	case *twoPhaseScanner:
+		discover, discoverText := hostWorst(s.discover, s.discoverOpts)
+		detect, detectText := hostWorst(s.detect, opts)
+		text := fmt.Sprintf("端口发现 %s，服务识别 %s", discoverText, detectText)
+		if discover == 0 || detect == 0 {
+			return 0, text
+		}
+		return discover + detect, text
+	case *nmapscan.ConnectScanner:
+		ports, worst, err := s.MaxDuration(opts)
+		if err != nil {
+			return 0, err.Error()
+		}
+		return worst, fmt.Sprintf("%s(%d个端口全部超时)", worst, ports)
+	}
+	timeout, err := nmapscan.HostTimeout(opts.Args)
+	switch {
+	case err != nil:
+		return 0, fmt.Sprintf("--host-timeout: %v", err)
+	case timeout == 0:
+		return 0, "没有上限(未设置 --host-timeout)"
+	}
+	return timeout, fmt.Sprintf("%s(--host-timeout)", timeout)
+}
+
+// 每个主机扫描的端口数及说明。分阶段扫描只计算端口发现阶段
+func hostPorts(scanner nmapscan.Scanner, opts nmapscan.Options) (int, string) {
+	switch s := scanner.(type) {
+	case *twoPhaseScanner:
+		ports, text := hostPorts(s.discover, s.discoverOpts)
+		return ports, "端口发现阶段 " + text + "，服务识别阶段只扫描发现的开放端口"
+	case *nmapscan.ConnectScanner:
+		ports, _, err := s.MaxDuration(opts)
+		if err != nil {
+			return 0, err.Error()
+		}
+		return ports, fmt.Sprintf("TCP %d个端口", ports)
+	}
+	tcp, udp, err := nmapscan.PortCount(opts.Args)
+	if err != nil {
+		return 0, err.Error()
+	}
+	var parts []string
+	if tcp > 0 {
+		parts = append(parts, fmt.Sprintf("TCP %d个端口", tcp))
+	}
+	if udp > 0 {
+		parts = append(parts, fmt.Sprintf("UDP %d个端口", udp))
+	}
+	if len(parts) == 0 {
+		parts = append(parts, "只做主机发现")
+	}
+	return tcp + udp, strings.Join(parts, "、")
+}
+
+func (p *scanPlan) print() {
+	for _, row := range p.rows {
+		switch {
+		case row.action == planScan:
+			logf("%s 第%d行 %s\n", planLabels[row.action], row.row+1, row.info.IP)
+		default:
+			target := row.info.IP
+			if target == "" {
+				target = row.info.Name
+			}
+			logf("%s 第%d行 %s: %s\n", planLabels[row.action], row.row+1, target, row.reason)
+		}
+	}
+
+	logf("\n扫描方式: %s，共 %d 个进程，同时运行 %d 个\n", p.scanner, len(p.commands), p.concurrency)
+	for _, cmd := range p.commands {
+		for _, line := range cmd.lines {
+			logf("  %s\n", line)
+		}
+		if len(cmd.targets) > 1 {
+			logf("    目标: %s\n", strings.Join(cmd.targets, ", "))
+		}
+	}
+
+	logf("\n共 %d 行: 扫描 %d 个主机", len(p.rows), p.hosts)
+	for _, action := range []string{statusNoIP, statusFailed, statusOutOfScope, statusPortFilled, statusDuplicate} {
+		if n := p.skipped[action]; n > 0 {
+			logf("，%s %d 行", strings.Trim(planLabels[action], "[]"), n)
+		}
+	}
+	logf("\n")
+	logf("端口探测: 每个主机 %s，共约 %d 次(不含重试和主机发现)\n", p.portsText, int64(p.hosts)*int64(p.ports))
+	logf("每个主机最长耗时: %s\n", p.worstText)
+	if p.hostWorst > 0 {
+		logf("最坏情况总耗时: %s\n", planDuration(p.total))
+	} else if p.hosts > 0 {
+		logf("最坏情况总耗时: 无法估算\n")
+	}
+}
+
+func planDuration(d time.Duration) string {
+	if d >= 24*time.Hour {
+		return fmt.Sprintf("%s (约 %.1f 天)", d, d.Hours()/24)
+	}
+	return d.String()
+}
+
+// 每行一条记录，同一批的行共用一条命令
+func (p *scanPlan) writeCSV(filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("创建扫描计划文件失败: %v", err)
+	}
+	defer file.Close()
+
+	// 写入BOM，Excel打开时中文不乱码
+	file.WriteString("\xEF\xBB\xBF")
+	w := csv.NewWriter(file)
+	w.Write([]string{"row", "number", "name", "domain", "ip", "source_port", "action", "reason", "command"})
+	for _, row := range p.rows {
+		command := ""
+		if row.command >= 0 {
+			command = strings.Join(p.commands[row.command].lines, "\n")
+		}
+		w.Write([]string{strconv.Itoa(row.row), row.info.Number, row.info.Name, row.info.Domain, row.info.IP, row.info.PORT, row.action, row.reason, command})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("写入扫描计划文件失败: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 风险等级，数字越大越严重
+var severityLevels = map[string]int{
+	"info":     1,
+	"low":      2,
+	"medium":   3,
+	"high":     4,
+	"critical": 5,
+}
+
+// Excel中显示的风险等级
+var severityNames = map[string]string{
+	"info":     "信息",
+	"low":      "低危",
+	"medium":   "中危",
+	"high":     "高危",
+	"critical": "严重",
+}
+
+// 规则文件中的一条规则，除 id/severity/finding 外的条件都为空时不限制，
+// 多个条件同时满足才算命中
+type policyRule struct {
+	ID       string   `yaml:"id"`
+	Severity string   `yaml:"severity"`
+	Finding  string   `yaml:"finding"`
+	Port     string   `yaml:"port"`     // 端口、范围或列表，如 "23"、"1433,3306"、"8000-8100"
+	Protocol string   `yaml:"protocol"` // tcp / udp
+	Service  string   `yaml:"service"`  // 服务名称正则，不区分大小写
+	Version  string   `yaml:"version"`  // 版本信息正则，不区分大小写
+	Org      string   `yaml:"org"`      // 所属单位正则
+	IP       []string `yaml:"ip"`       // IP或网段
+	State    string   `yaml:"state"`    // 端口状态，默认为 open
+}
+
+// 端口命中的规则
+type finding struct {
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"`
+	Finding  string `json:"finding"`
+}
+
+type portRange struct{ from, to int }
+
+// 解析后的规则
+type compiledRule struct {
+	policyRule
+	ports    []portRange
+	service  *regexp.Regexp
+	version  *regexp.Regexp
+	org      *regexp.Regexp
+	prefixes []netip.Prefix
+}
+
+type policy struct {
+	rules []compiledRule
+}
+
+// 读取YAML规则文件
+func loadPolicy(filename string) (*policy, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("读取规则文件失败: %v", err)
+	}
+	var doc struct {
+		Rules []policyRule `yaml:"rules"`
+	}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("解析规则文件失败: %v", err)
+	}
+
+	p := &policy{}
+	for i, r := range doc.Rules {
+		rule, err := compileRule(r)
+		if err != nil {
+			name := r.ID
+			if name == "" {
+				name = fmt.Sprintf("第%d条", i+1)
+			}
+			return nil, fmt.Errorf("规则 %s: %v", name, err)
+		}
+		p.rules = append(p.rules, rule)
+	}
+	return p, nil
+}
+
+func compileRule(r policyRule) (compiledRule, error) {
+	rule := compiledRule{policyRule: r}
+	if r.ID == "" || r.Finding == "" {
+		return rule, fmt.Errorf("缺少 id 或 finding")
+	}
+	rule.Severity = strings.ToLower(r.Severity)
+	if _, ok := severityLevels[rule.Severity]; !ok {
+		return rule, fmt.Errorf("风险等级 %q 无效，可选 critical/high/medium/low/info", r.Severity)
+	}
+	if rule.State == "" {
+		rule.State = "open"
+	}
+
+	for _, part := range strings.Split(r.Port, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		from, to, isRange := strings.Cut(part, "-")
+		start, err := strconv.Atoi(from)
+		if err != nil {
+			return rule, fmt.Errorf("端口 %q 无效", part)
+		}
+		end := start
+		if isRange {
+			if end, err = strconv.Atoi(to); err != nil || end < start {
+				return rule, fmt.Errorf("端口 %q 无效", part)
+			}
+		}
+		rule.ports = append(rule.ports, portRange{start, end})
+	}
+
+	var err error
+	compile := func(expr string) *regexp.Regexp {
+		if expr == "" || err != nil {
+			return nil
+		}
+		var re *regexp.Regexp
+		if re, err = regexp.Compile("(?i)" + expr); err != nil {
+			err = fmt.Errorf("正则表达式 %q 无效: %v", expr, err)
+		}
+		return re
+	}
+	rule.service = compile(r.Service)
+	rule.version = compile(r.Version)
+	rule.org = compile(r.Org)
+	if err != nil {
+		return rule, err
+	}
+
+	for _, s := range r.IP {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(s)
+			if addrErr != nil {
+				return rule, fmt.Errorf("IP或网段 %q 无效", s)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		rule.prefixes = append(rule.prefixes, prefix.Masked())
+	}
+	return rule, nil
+}
+
+func (r *compiledRule) match(info ExcelInfo, port PortInfo) bool {
+	if !strings.EqualFold(port.State, r.State) {
+		return false
+	}
+	if r.Protocol != "" && !strings.EqualFold(port.Protocol, r.Protocol) {
+		return false
+	}
+	if len(r.ports) > 0 {
+		n, err := strconv.Atoi(port.Port)
+		if err != nil {
+			return false
+		}
+		found := false
+		for _, pr := range r.ports {
+			if n >= pr.from && n <= pr.to {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if r.service != nil && !r.service.MatchString(port.Service) {
+		return false
+	}
+	if r.version != nil && !r.version.MatchString(port.Version) {
+		return false
+	}
+	if r.org != nil && !r.org.MatchString(info.Number) {
+		return false
+	}
+	if len(r.prefixes) > 0 {
+		addr, err := netip.ParseAddr(info.IP)
+		if err != nil {
+			return false
+		}
+		found := false
+		for _, prefix := range r.prefixes {
+			if prefix.Contains(addr.Unmap()) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// 对每个端口匹配规则，命中的规则记录在端口的 Findings 中
+func (p *policy) apply(info ExcelInfo, result *ScanResult) {
+	if p == nil {
+		return
+	}
+	for i := range result.Ports {
+		port := &result.Ports[i]
+		port.Findings = nil
+		for j := range p.rules {
+			rule := &p.rules[j]
+			if rule.match(info, *port) {
+				port.Findings = append(port.Findings, finding{Rule: rule.ID, Severity: rule.Severity, Finding: rule.Finding})
+			}
+		}
+	}
+}
+
+// 端口命中规则中最高的风险等级，没有命中时为空
+func highestSeverity(findings []finding) string {
+	highest := ""
+	for _, f := range findings {
+		if severityLevels[f.Severity] > severityLevels[highest] {
+			highest = f.Severity
+		}
+	}
+	return highest
+}
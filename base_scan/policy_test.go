@@ -0,0 +1,121 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writePolicy(t *testing.T, content string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestPolicyApply(t *testing.T) {
+	p, err := loadPolicy(writePolicy(t, `
+rules:
+  - id: db
+    severity: High
+    finding: 数据库端口暴露
+    port: "1433, 3306,5432-5433"
+    protocol: tcp
+  - id: old-openssh
+    severity: medium
+    finding: OpenSSH版本过旧
+    service: ^ssh$
+    version: openssh [4-6]\.
+  - id: internal-http
+    severity: low
+    finding: 内网Web服务
+    service: http
+    ip: [10.0.0.0/8, 192.0.2.10]
+    org: 单位A
+  - id: filtered-telnet
+    severity: info
+    finding: Telnet端口被过滤
+    port: "23"
+    state: filtered
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		info  ExcelInfo
+		port  PortInfo
+		rules []string
+	}{
+		// 端口列表和范围，风险等级不区分大小写
+		{ExcelInfo{IP: "203.0.113.1"}, PortInfo{Port: "3306", Protocol: "tcp", State: "open"}, []string{"db"}},
+		{ExcelInfo{IP: "203.0.113.1"}, PortInfo{Port: "5433", Protocol: "tcp", State: "open"}, []string{"db"}},
+		{ExcelInfo{IP: "203.0.113.1"}, PortInfo{Port: "5434", Protocol: "tcp", State: "open"}, nil},
+		{ExcelInfo{IP: "203.0.113.1"}, PortInfo{Port: "3306", Protocol: "udp", State: "open"}, nil},
+		// 默认只匹配开放的端口
+		{ExcelInfo{IP: "203.0.113.1"}, PortInfo{Port: "3306", Protocol: "tcp", State: "closed"}, nil},
+		{ExcelInfo{IP: "203.0.113.1"}, PortInfo{Port: "23", Protocol: "tcp", State: "filtered"}, []string{"filtered-telnet"}},
+		// 服务和版本正则不区分大小写
+		{ExcelInfo{IP: "203.0.113.1"}, PortInfo{Port: "2222", Protocol: "tcp", State: "open", Service: "SSH", Version: "OpenSSH 5.3 (protocol 2.0)"}, []string{"old-openssh"}},
+		{ExcelInfo{IP: "203.0.113.1"}, PortInfo{Port: "22", Protocol: "tcp", State: "open", Service: "ssh", Version: "OpenSSH 9.6p1"}, nil},
+		{ExcelInfo{IP: "203.0.113.1"}, PortInfo{Port: "22", Protocol: "tcp", State: "open", Service: "ssh-alt", Version: "OpenSSH 5.3"}, nil},
+		// 网段、单个IP和所属单位同时满足
+		{ExcelInfo{Number: "单位A", IP: "10.1.2.3"}, PortInfo{Port: "8080", Protocol: "tcp", State: "open", Service: "ssl/http"}, []string{"internal-http"}},
+		{ExcelInfo{Number: "单位A", IP: "192.0.2.10"}, PortInfo{Port: "80", Protocol: "tcp", State: "open", Service: "http"}, []string{"internal-http"}},
+		{ExcelInfo{Number: "单位B", IP: "10.1.2.3"}, PortInfo{Port: "80", Protocol: "tcp", State: "open", Service: "http"}, nil},
+		{ExcelInfo{Number: "单位A", IP: "192.0.2.11"}, PortInfo{Port: "80", Protocol: "tcp", State: "open", Service: "http"}, nil},
+		{ExcelInfo{Number: "单位A", IP: "www.example.com"}, PortInfo{Port: "80", Protocol: "tcp", State: "open", Service: "http"}, nil},
+	}
+	for _, tt := range tests {
+		result := ScanResult{Ports: []PortInfo{tt.port}}
+		p.apply(tt.info, &result)
+		var got []string
+		for _, f := range result.Ports[0].Findings {
+			got = append(got, f.Rule)
+		}
+		if !reflect.DeepEqual(got, tt.rules) {
+			t.Errorf("%s %s/%s %s %q 命中 %q，应为 %q", tt.info.IP, tt.port.Port, tt.port.Protocol, tt.port.State, tt.port.Service, got, tt.rules)
+		}
+	}
+
+	// 同时命中多条规则时取最高的风险等级
+	result := ScanResult{Ports: []PortInfo{{Port: "1433", Protocol: "tcp", State: "open", Service: "http"}}}
+	p.apply(ExcelInfo{Number: "单位A", IP: "10.0.0.1"}, &result)
+	if got := highestSeverity(result.Ports[0].Findings); len(result.Ports[0].Findings) != 2 || got != "high" {
+		t.Errorf("命中 %+v，最高等级 %q，应为 high", result.Ports[0].Findings, got)
+	}
+}
+
+func TestLoadPolicyErrors(t *testing.T) {
+	tests := []struct {
+		content string
+		err     string
+	}{
+		{"rules: [", "解析规则文件失败"},
+		{"rules:\n  - id: x\n    severity: high\n    finding: [a", "解析规则文件失败"},
+		{"rules:\n  - severity: high\n    finding: x", "第1条: 缺少 id 或 finding"},
+		{"rules:\n  - id: x\n    severity: urgent\n    finding: x", "规则 x: 风险等级"},
+		{"rules:\n  - id: x\n    severity: high\n    finding: x\n    port: 80-20", `端口 "80-20" 无效`},
+		{"rules:\n  - id: x\n    severity: high\n    finding: x\n    port: http", `端口 "http" 无效`},
+		{"rules:\n  - id: x\n    severity: high\n    finding: x\n    version: \"(\"", "正则表达式"},
+		{"rules:\n  - id: x\n    severity: high\n    finding: x\n    ip: [10.0.0.0/33]", "IP或网段"},
+	}
+	for _, tt := range tests {
+		_, err := loadPolicy(writePolicy(t, tt.content))
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("loadPolicy(%q) 错误 %v，应包含 %q", tt.content, err, tt.err)
+		}
+	}
+
+	if _, err := loadPolicy(filepath.Join(t.TempDir(), "missing.yaml")); err == nil || !strings.Contains(err.Error(), "读取规则文件失败") {
+		t.Errorf("文件不存在时错误 %v", err)
+	}
+	// 示例规则文件可以直接使用
+	if _, err := loadPolicy("policy.example.yaml"); err != nil {
+		t.Errorf("policy.example.yaml: %v", err)
+	}
+}
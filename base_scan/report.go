@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"html/template"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+//go:embed report.html
+var reportTemplate string
+
+// HTML报告，所有记录在Close时生成一个不依赖外部资源的HTML文件
+type htmlWriter struct {
+	filename string
+	hosts    []hostRecord
+}
+
+func (w *htmlWriter) Write(rec hostRecord) error {
+	w.hosts = append(w.hosts, rec)
+	return nil
+}
+
+func (w *htmlWriter) Close() error {
+	tmpl, err := template.New("report").Funcs(template.FuncMap{
+		"join":         strings.Join,
+		"severityName": func(s string) string { return severityNames[s] },
+		"highest":      highestSeverity,
+		"first": func(n int, s []string) []string {
+			if len(s) > n {
+				return s[:n]
+			}
+			return s
+		},
+	}).Parse(reportTemplate)
+	if err != nil {
+		return fmt.Errorf("解析报告模板失败: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, newReport(w.hosts)); err != nil {
+		return fmt.Errorf("生成HTML报告失败: %v", err)
+	}
+	if err := os.WriteFile(w.filename, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("写入HTML报告失败: %v", err)
+	}
+	return nil
+}
+
+// 报告模板的数据
+type report struct {
+	GeneratedAt string
+	Hosts       int
+	Scanned     int
+	Failed      int
+	NoIP        int
+	OutOfScope  int
+	PortFilled  int
+	Duplicate   int
+	OpenPorts   int
+	States      []string
+	Severities  []severityCount
+	Orgs        []reportOrg
+}
+
+type severityCount struct {
+	Severity string
+	Count    int
+}
+
+// 按所属单位分组
+type reportOrg struct {
+	Name      string
+	Hosts     []hostRecord
+	OpenPorts int
+}
+
+func newReport(hosts []hostRecord) report {
+	r := report{GeneratedAt: time.Now().Format("2006-01-02 15:04:05"), Hosts: len(hosts)}
+
+	states := make(map[string]bool)
+	severities := make(map[string]int)
+	orgIndex := make(map[string]int)
+	for _, h := range hosts {
+		switch h.Status {
+		case statusScanned, statusInterrupted:
+			r.Scanned++
+		case statusFailed:
+			r.Failed++
+		case statusNoIP:
+			r.NoIP++
+		case statusOutOfScope:
+			r.OutOfScope++
+		case statusPortFilled:
+			r.PortFilled++
+		case statusDuplicate:
+			r.Duplicate++
+		}
+
+		name := h.Number
+		if name == "" {
+			name = "未填写所属单位"
+		}
+		i, ok := orgIndex[name]
+		if !ok {
+			i = len(r.Orgs)
+			orgIndex[name] = i
+			r.Orgs = append(r.Orgs, reportOrg{Name: name})
+		}
+		org := &r.Orgs[i]
+		org.Hosts = append(org.Hosts, h)
+
+		for _, p := range h.Ports {
+			states[p.State] = true
+			if p.State == "open" {
+				r.OpenPorts++
+				org.OpenPorts++
+			}
+			for _, f := range p.Findings {
+				severities[f.Severity]++
+			}
+		}
+	}
+
+	for state := range states {
+		r.States = append(r.States, state)
+	}
+	sort.Strings(r.States)
+	for severity, count := range severities {
+		r.Severities = append(r.Severities, severityCount{severity, count})
+	}
+	sort.Slice(r.Severities, func(i, j int) bool {
+		return severityLevels[r.Severities[i].Severity] > severityLevels[r.Severities[j].Severity]
+	})
+	return r
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	nmapscan "github.com/helar52-xl/batch_scan_ip_base_nmap/nmap_scan"
+)
+
+// 用 testdata/replay 中录制的nmap结果生成HTML报告，检查汇总和各单位的主机、端口数
+func TestHTMLReportReplay(t *testing.T) {
+	source := writeSourceExcel(t, [][]interface{}{
+		{"所属单位", "网站名称", "IP", "端口", "备注"},
+		{"单位A", "门户", "192.0.2.10", "", "生产"},
+		{"单位A", "备用", "192.0.2.11"},
+		{"单位B", "", "192.0.2.12", "443"},
+		{"单位B", "", "192.0.2.10"},
+		{"", "没有IP"},
+	})
+	dir := t.TempDir()
+	output := filepath.Join(dir, "report.html")
+	err := runBatch(context.Background(), batchOptions{
+		SourceExcel: source,
+		NmapArgs:    "-sV -O",
+		ExcelOutput: filepath.Join(dir, "result.xlsx"),
+		HTMLOutput:  output,
+		PolicyFile:  writePolicy(t, "rules:\n  - id: ssh\n    severity: medium\n    finding: SSH暴露\n    service: ssh\n"),
+		Concurrency: 2,
+		Scanner:     &nmapscan.ReplayScanner{Dir: filepath.Join("testdata", "replay")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	html := string(data)
+
+	cards := make(map[string]string)
+	for _, m := range regexp.MustCompile(`<div class="card[^"]*">([^<]+)<b>([^<]*)</b>`).FindAllStringSubmatch(html, -1) {
+		cards[m[1]] = m[2]
+	}
+	want := map[string]string{
+		"主机":     "5",
+		"已扫描":    "2",
+		"扫描失败":   "0",
+		"无IP":    "1",
+		"超出授权范围": "0",
+		"已有端口":   "1",
+		"重复":     "1",
+		"开放端口":   "2",
+		"所属单位":   "3",
+		"中危":     "1",
+	}
+	for name, w := range want {
+		if cards[name] != w {
+			t.Errorf("汇总 %s = %q，应为 %q", name, cards[name], w)
+		}
+	}
+
+	for _, s := range []string{
+		"<h2>单位A</h2> <span class=\"muted\">2 台主机，2 个开放端口</span>",
+		"<h2>单位B</h2> <span class=\"muted\">2 台主机，0 个开放端口</span>",
+		"<h2>未填写所属单位</h2> <span class=\"muted\">1 台主机，0 个开放端口</span>",
+		"<td>nginx 1.10.3</td>",
+		"<div>SSH暴露</div>",
+	} {
+		if !strings.Contains(html, s) {
+			t.Errorf("报告中没有 %q", s)
+		}
+	}
+	if n := strings.Count(html, "<tr data-port="); n != 2 {
+		t.Errorf("端口表 %d 行，应为 2 行", n)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// 域名解析器，server为空时使用系统DNS配置
+type domainResolver struct {
+	resolver *net.Resolver
+	timeout  time.Duration
+}
+
+func newDomainResolver(server string, timeout time.Duration) *domainResolver {
+	r := &domainResolver{resolver: net.DefaultResolver, timeout: timeout}
+	if server != "" {
+		// 未指定端口时默认53
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+		r.resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, server)
+			},
+		}
+	}
+	return r
+}
+
+// 查询A/AAAA记录，IPv4在前
+func (r *domainResolver) lookup(host string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	addrs, err := r.resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	var v4, v6 []string
+	for _, addr := range addrs {
+		if ip := addr.IP.To4(); ip != nil {
+			v4 = append(v4, ip.String())
+		} else {
+			v6 = append(v6, addr.IP.String())
+		}
+	}
+	return append(v4, v6...), nil
+}
+
+// 从网站地址中取出主机名，去掉协议、路径、端口，如 https://www.example.com:8443/login -> www.example.com
+func domainHost(domain string) string {
+	domain = strings.TrimSpace(domain)
+	if domain == "" {
+		return ""
+	}
+	if !strings.Contains(domain, "://") {
+		domain = "//" + domain
+	}
+	u, err := url.Parse(domain)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(u.Hostname(), ".")
+}
+
+// 对没有IP但有网站地址的行解析域名，每个解析出的地址单独成行，
+// 并在IPSource中记录该IP来自DNS解析
+func resolveInfos(infos []ExcelInfo, r *domainResolver) []ExcelInfo {
+	var resolved []ExcelInfo
+	for _, info := range infos {
+		host := domainHost(info.Domain)
+		if info.IP != "" || host == "" {
+			resolved = append(resolved, info)
+			continue
+		}
+
+		// 网站地址本身就是IP时无需解析
+		if ip := net.ParseIP(host); ip != nil {
+			info.IP = ip.String()
+			resolved = append(resolved, info)
+			continue
+		}
+
+		addrs, err := r.lookup(host)
+		if err == nil && len(addrs) == 0 {
+			err = errors.New("没有A/AAAA记录")
+		}
+		if err != nil {
+			logf("解析域名 %s 失败: %v\n", host, err)
+			info.IPSource = "DNS解析失败: " + host
+			resolved = append(resolved, info)
+			continue
+		}
+
+		logf("域名 %s 解析结果: %s\n", host, strings.Join(addrs, ", "))
+		for _, addr := range addrs {
+			row := info
+			row.IP = addr
+			row.IPSource = "DNS解析: " + host
+			resolved = append(resolved, row)
+		}
+	}
+	return resolved
+}
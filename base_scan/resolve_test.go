@@ -0,0 +1,120 @@
+package main
+
+import (
+	"net"
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// 在127.0.0.1上启动一个UDP DNS服务，按records回答A/AAAA查询。
+// 不在records中的域名返回NXDOMAIN，地址列表为空的域名返回没有记录的应答
+func startDNSStub(t *testing.T, records map[string][]string) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var msg dnsmessage.Message
+			if err := msg.Unpack(buf[:n]); err != nil || len(msg.Questions) != 1 {
+				continue
+			}
+			q := msg.Questions[0]
+			msg.Header.Response = true
+			msg.Header.Authoritative = true
+			msg.Header.RecursionAvailable = true
+			addrs, ok := records[strings.TrimSuffix(strings.ToLower(q.Name.String()), ".")]
+			if !ok {
+				msg.Header.RCode = dnsmessage.RCodeNameError
+			}
+			for _, s := range addrs {
+				a := netip.MustParseAddr(s)
+				head := dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: 60}
+				switch {
+				case q.Type == dnsmessage.TypeA && a.Is4():
+					head.Type = dnsmessage.TypeA
+					msg.Answers = append(msg.Answers, dnsmessage.Resource{Header: head, Body: &dnsmessage.AResource{A: a.As4()}})
+				case q.Type == dnsmessage.TypeAAAA && a.Is6():
+					head.Type = dnsmessage.TypeAAAA
+					msg.Answers = append(msg.Answers, dnsmessage.Resource{Header: head, Body: &dnsmessage.AAAAResource{AAAA: a.As16()}})
+				}
+			}
+			reply, err := msg.Pack()
+			if err != nil {
+				continue
+			}
+			conn.WriteTo(reply, addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+// 使用DNS服务桩的解析器，测试不依赖系统DNS
+func newStubResolver(t *testing.T, records map[string][]string) *domainResolver {
+	t.Helper()
+	return newDomainResolver(startDNSStub(t, records), 5*time.Second)
+}
+
+func TestDomainResolverLookup(t *testing.T) {
+	r := newStubResolver(t, map[string][]string{
+		"www.example.test": {"fd00::1", "10.0.0.2", "10.0.0.1"},
+	})
+	addrs, err := r.lookup("www.example.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// IPv4在前
+	if len(addrs) != 3 || addrs[2] != "fd00::1" || !strings.HasPrefix(addrs[0], "10.") || !strings.HasPrefix(addrs[1], "10.") {
+		t.Errorf("lookup = %q，应为两个IPv4地址在前", addrs)
+	}
+	if _, err := r.lookup("missing.example.test"); err == nil {
+		t.Error("不存在的域名应返回错误")
+	}
+}
+
+func TestResolveInfos(t *testing.T) {
+	r := newStubResolver(t, map[string][]string{
+		"www.example.test":   {"10.0.0.1", "fd00::1"},
+		"empty.example.test": {},
+	})
+	infos := []ExcelInfo{
+		{Number: "单位A", Domain: "https://www.example.test:8443/login"},
+		// 已有IP的行不解析
+		{Number: "单位B", Domain: "www.example.test", IP: "10.9.9.9"},
+		// 网站地址本身就是IP
+		{Number: "单位C", Domain: "http://10.1.1.1/"},
+		{Number: "单位D", Domain: "empty.example.test"},
+		{Number: "单位E", Domain: "missing.example.test"},
+		{Number: "单位F"},
+	}
+
+	var got [][3]string
+	for _, info := range resolveInfos(infos, r) {
+		got = append(got, [3]string{info.Number, info.IP, info.IPSource})
+	}
+	want := [][3]string{
+		{"单位A", "10.0.0.1", "DNS解析: www.example.test"},
+		{"单位A", "fd00::1", "DNS解析: www.example.test"},
+		{"单位B", "10.9.9.9", ""},
+		{"单位C", "10.1.1.1", ""},
+		{"单位D", "", "DNS解析失败: empty.example.test"},
+		{"单位E", "", "DNS解析失败: missing.example.test"},
+		{"单位F", "", ""},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("resolveInfos =\n%q\n应为\n%q", got, want)
+	}
+}
@@ -1,15 +1,17 @@
 package main
 
 import (
-	"bufio"
+	"context"
 	"flag"
 	"fmt"
 	"os"
-	"os/exec"
-	"regexp"
+	"os/signal"
+	"path/filepath"
 	"strings"
+	"syscall"
 	"time"
 
+	nmapscan "github.com/helar52-xl/batch_scan_ip_base_nmap/nmap_scan"
 	"github.com/xuri/excelize/v2"
 )
 
@@ -17,6 +19,22 @@ type ScanResult struct {
 	OS        []string
 	OSGuesses []string
 	Ports     []PortInfo
+	OSMatches []nmapscan.OSMatch // 带准确率的完整操作系统匹配
+	Meta      nmapscan.Meta      // 扫描元数据
+	// 主机级别的NSE脚本输出
+	HostScripts []ScriptOutput
+	// 主机信息，见 host.go
+	HostState  string // up / down，为空表示未知
+	HostReason string // 判断依据，如 echo-reply、no-response
+	Latency    time.Duration
+	MAC        string
+	MACVendor  string
+	RDNS       string // 反向DNS解析得到的主机名
+	Uptime     time.Duration
+	LastBoot   string
+	Distance   int // 网络距离(跳数)
+	Hops       []nmapscan.Hop
+	ExtraPorts []nmapscan.ExtraPorts // 未列出的端口汇总，如1000个filtered
 }
 
 type PortInfo struct {
@@ -25,242 +43,458 @@ type PortInfo struct {
 	Service  string
 	Version  string
 	State    string
+	// 以下字段来自nmap XML的 <service>
+	Product        string
+	ProductVersion string
+	ExtraInfo      string
+	CPE            []string
+	// 命中的风险规则，见 -policy
+	Findings []finding
+	// 匹配到的漏洞，按CVSS分数从高到低排列，见 -cve
+	CVEs []string
+	CVSS float64
+	// NSE脚本输出，http-title 和 ssl-cert 另外单独成列
+	Scripts   []ScriptOutput
+	HTTPTitle string
+	SSLCert   string
 }
 
 // 添加新的结构体用于存储Excel中的信息
 type ExcelInfo struct {
-	Number string
-	Name   string
-	Domain string
-	IP     string
-	PORT   string
-	REMARK   string 
+	Number      string
+	Name        string
+	Domain      string
+	IP          string
+	PORT        string
+	REMARK      string
+	IPSource    string // IP来源，如通过网站地址DNS解析得到
+	OutOfScope  string // 超出授权范围的原因，非空时不扫描，见 -scope
+	TargetError string // 目标无法解析或网段过大的原因，非空时不扫描
+	Duplicate   string // 与前面的行目标相同时说明是哪一行，非空时不扫描
+	// 在源记录中的序号(从1开始)和IP列的原始内容(IP为空时为网站地址)，
+	// 网段展开和域名解析得到的行与原行相同，状态文件据此对应续扫的行
+	SourceRow    int
+	SourceTarget string
 }
 
-func parseNmapOutput(output string) ScanResult {
-	result := ScanResult{
-		OS:        make([]string, 0),
-		OSGuesses: make([]string, 0),
-		Ports:     make([]PortInfo, 0),
+// 扫描前判断一行的处理方式，返回导出中的 status 和不扫描的原因，需要扫描时为 statusScanned。
+// runBatch、-plan 和状态列的说明都按这里的顺序判断
+func classifyRow(info ExcelInfo) (status, reason string) {
+	switch {
+	case info.IP == "":
+		return statusNoIP, "没有IP"
+	case info.TargetError != "":
+		return statusFailed, "目标无效: " + info.TargetError
+	case info.OutOfScope != "":
+		return statusOutOfScope, "超出授权范围: " + info.OutOfScope
+	case info.PORT != "":
+		// 端口列已填写的行视为已有结果
+		return statusPortFilled, "端口列已填写"
+	case info.Duplicate != "":
+		return statusDuplicate, "重复的目标: " + info.Duplicate
 	}
+	return statusScanned, ""
+}
 
-	// 解析操作系统信息
-	osRegex := regexp.MustCompile(`OS details: (.+)`)
-	if matches := osRegex.FindStringSubmatch(output); len(matches) > 1 {
-		result.OS = append(result.OS, matches[1])
-	}
+// 是否需要扫描
+func (info ExcelInfo) scannable() bool {
+	status, _ := classifyRow(info)
+	return status == statusScanned
+}
 
-	// 添加解析操作系统猜测信息
-	osGuessRegex := regexp.MustCompile(`Aggressive OS guesses: (.+)`)
-	if matches := osGuessRegex.FindStringSubmatch(output); len(matches) > 1 {
-		result.OSGuesses = append(result.OSGuesses, matches[1])
+// 没有扫描的行在状态列中以此结尾，后面可以附上原因，diff 据此跳过这些行
+const notScannedState = "，未扫描"
+
+// 没有端口行时状态列的说明，如 "超出授权范围，未扫描: 原因"
+func emptyRowState(info ExcelInfo, result ScanResult) string {
+	switch status, reason := classifyRow(info); status {
+	case statusNoIP:
+		return ""
+	case statusScanned:
+		return hostStateText(result)
+	default:
+		label, detail, found := strings.Cut(reason, ": ")
+		if !found {
+			return label + notScannedState
+		}
+		return label + notScannedState + ": " + detail
 	}
+}
 
-	// 修改解析端口信息部分
-	portRegex := regexp.MustCompile(`(\d+)/(tcp|udp)\s+(\w+)\s+(.*)`)
-	scanner := bufio.NewScanner(strings.NewReader(output))
-	for scanner.Scan() {
-		line := scanner.Text()
-		if matches := portRegex.FindStringSubmatch(line); len(matches) > 1 {
-			serviceInfo := matches[4]
-
-			// 分离服务名称和版本信息
-			service := serviceInfo
-			version := ""
+// 状态列是否为 emptyRowState 给出的未扫描说明
+func isNotScannedState(cell string) bool {
+	reason, _, _ := strings.Cut(cell, ":")
+	return strings.HasSuffix(reason, notScannedState)
+}
 
-			// 如果包含空格，第一个空格前的是服务名，后面的是版本信息
-			if idx := strings.Index(serviceInfo, " "); idx != -1 {
-				service = strings.TrimSpace(serviceInfo[:idx])
-				version = strings.TrimSpace(serviceInfo[idx+1:])
+// 将nmap XML中的主机信息转换为ScanResult
+func resultFromHost(host nmapscan.Host, meta nmapscan.Meta) ScanResult {
+	result := ScanResult{
+		OS:          make([]string, 0),
+		OSGuesses:   make([]string, 0),
+		Ports:       make([]PortInfo, 0),
+		OSMatches:   host.OS.Matches,
+		Meta:        meta,
+		HostScripts: scriptOutputs(host.HostScripts),
+	}
+	fillHostInfo(&result, host)
 
-				// // 如果有版本信息，则交换服务和版本
-				// if version != "" {
-				// 	service, version = version, service
-				// }
-			}
+	// 精确匹配对应普通输出中的 "OS details"
+	for _, m := range host.OS.Exact() {
+		result.OS = append(result.OS, m.Name)
+	}
+	// 其余匹配对应 "Aggressive OS guesses"
+	for _, m := range host.OS.Guesses() {
+		result.OSGuesses = append(result.OSGuesses, m.String())
+	}
 
-			portInfo := PortInfo{
-				Port:     matches[1],
-				Protocol: matches[2],
-				State:    matches[3],
-				Service:  service,
-				Version:  version,
-			}
-			result.Ports = append(result.Ports, portInfo)
+	for _, port := range host.Ports {
+		info := PortInfo{
+			Port:           port.ID(),
+			Protocol:       port.Protocol,
+			State:          port.State.State,
+			Service:        port.Service.DisplayName(),
+			Version:        port.Service.Detail(),
+			Product:        port.Service.Product,
+			ProductVersion: port.Service.Version,
+			ExtraInfo:      port.Service.ExtraInfo,
+			CPE:            port.Service.CPEs,
+			Scripts:        scriptOutputs(port.Scripts),
 		}
+		promoteScripts(&info, port.Scripts)
+		result.Ports = append(result.Ports, info)
 	}
 
 	return result
 }
 
-func scanIP(ip string, nmapArgs string) (ScanResult, time.Duration, error) {
-	start := time.Now()
-	args := append(strings.Split(nmapArgs, " "), ip)
-	cmd := exec.Command("nmap", args...)
+// 取nmap结果中第一个主机的结果。扫描被中断时结果不完整，尽量保留已有的结果
+func resultFromRun(run *nmapscan.Run) ScanResult {
+	if len(run.Hosts) == 0 {
+		result := ScanResult{
+			OS:        make([]string, 0),
+			OSGuesses: make([]string, 0),
+			Ports:     make([]PortInfo, 0),
+			Meta:      run.Meta(),
+		}
+		// 主机不在线时nmap默认不输出 <host>，只在 runstats 中计数
+		if !run.Incomplete && run.RunStats.Hosts.Down > 0 && run.RunStats.Hosts.Up == 0 {
+			result.HostState = hostDown
+		}
+		return result
+	}
+	return resultFromHost(run.Hosts[0], run.Meta())
+}
 
-	output, err := cmd.CombinedOutput()
+func scanIP(ctx context.Context, scanner nmapscan.Scanner, ip string, opts nmapscan.Options) (ScanResult, time.Duration, error) {
+	start := time.Now()
+	run, err := scanner.Scan(ctx, ip, opts)
 	if err != nil {
+		if ctx.Err() != nil {
+			var result ScanResult
+			if run != nil {
+				result = resultFromRun(run)
+			}
+			return result, time.Since(start), fmt.Errorf("扫描被中断: %w", ctx.Err())
+		}
 		return ScanResult{}, 0, fmt.Errorf("扫描错误: %v", err)
 	}
+	result := resultFromRun(run)
 
-	// 解析扫描结果
-	result := parseNmapOutput(string(output))
+	// 输出格式化结果，整块输出避免并发扫描时交错
+	logf("%s", formatResult(ip, result))
 
-	// 输出格式化结果
-	fmt.Printf("\n%s\n", strings.Repeat("=", 50))
-	fmt.Printf("IP地址: %s\n\n", ip)
+	end := time.Now()
+	duration := end.Sub(start)
+	return result, duration, nil
+}
+
+// 一批目标中单个主机的扫描结果
+type hostScan struct {
+	result   ScanResult
+	start    time.Time
+	duration time.Duration
+	err      error
+}
+
+// 一次nmap扫描多个IP，结果按IP拆分，与逐个扫描时一致。扫描被中断时已完成的主机仍然有效
+func scanIPs(ctx context.Context, scanner nmapscan.BatchScanner, ips []string, opts nmapscan.Options) []hostScan {
+	start := time.Now()
+	scans := make([]hostScan, len(ips))
+	run, err := scanner.ScanBatch(ctx, ips, opts)
+	duration := time.Since(start)
+	switch {
+	case ctx.Err() != nil:
+		err = fmt.Errorf("扫描被中断: %w", ctx.Err())
+		// 没有输出的主机可能尚未扫描，不能视为离线
+		if run != nil {
+			run.Incomplete = true
+		}
+	case err != nil:
+		err = fmt.Errorf("扫描错误: %v", err)
+		run = nil
+	}
+	if run == nil {
+		for i := range scans {
+			scans[i] = hostScan{start: start, err: err}
+		}
+		return scans
+	}
+
+	for i, single := range nmapscan.SplitRun(run, ips) {
+		scan := hostScan{result: resultFromRun(single), start: start, duration: duration}
+		if single.Incomplete {
+			scan.err = err
+		} else {
+			// 使用nmap记录的单个主机的开始和结束时间
+			if len(single.Hosts) > 0 && single.Hosts[0].StartTime > 0 && single.Hosts[0].EndTime >= single.Hosts[0].StartTime {
+				scan.start = time.Unix(single.Hosts[0].StartTime, 0)
+				scan.duration = time.Duration(single.Hosts[0].EndTime-single.Hosts[0].StartTime) * time.Second
+			}
+			logf("%s", formatResult(ips[i], scan.result))
+		}
+		scans[i] = scan
+	}
+	return scans
+}
+
+// 格式化单个IP的扫描结果
+func formatResult(ip string, result ScanResult) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "\n%s\n", strings.Repeat("=", 50))
+	fmt.Fprintf(&b, "IP地址: %s\n", ip)
+	if state := hostStateCell(result); state != "" {
+		fmt.Fprintf(&b, "主机状态: %s\n", state)
+	}
+	if result.RDNS != "" {
+		fmt.Fprintf(&b, "反向DNS: %s\n", result.RDNS)
+	}
+	if result.MAC != "" {
+		fmt.Fprintf(&b, "MAC地址: %s %s\n", result.MAC, result.MACVendor)
+	}
+	if len(result.Meta.Phases) > 0 {
+		fmt.Fprintf(&b, "阶段耗时: %s\n", phasesText(result.Meta.Phases))
+	}
+	b.WriteString("\n")
 
 	// 输出操作系统信息
-	fmt.Println("操作系统:")
+	b.WriteString("操作系统:\n")
 	if len(result.OS) > 0 {
 		for _, os := range result.OS {
-			fmt.Printf("- %s\n", os)
+			fmt.Fprintf(&b, "- %s\n", os)
 		}
 	} else {
-		fmt.Println("- 未检测到操作系统")
+		b.WriteString("- 未检测到操作系统\n")
 	}
 
 	// 输出端口信息
-	fmt.Println("\n端口信息:")
+	b.WriteString("\n端口信息:\n")
 	for _, port := range result.Ports {
-		fmt.Printf("- %s/%s: %s %s\n",
+		fmt.Fprintf(&b, "- %s/%s: %s %s\n",
 			port.Port,
 			port.Protocol,
 			port.Service,
 			port.State)
 	}
-
-	end := time.Now()
-	duration := end.Sub(start)
-	return result, duration, nil
+	return b.String()
 }
 
 // 修改readExcel函数
-func readExcel(filename string) ([]ExcelInfo, error) {
+// 读取源Excel，按表头文字定位各列，sheet 为工作表名称或序号，为空时使用 Sheet1 或第一个工作表
+func readExcel(filename string, sheet string, columns []nmapscan.Column) ([]ExcelInfo, error) {
 	f, err := excelize.OpenFile(filename)
 	if err != nil {
 		return nil, fmt.Errorf("打开Excel文件失败: %v", err)
 	}
 	defer f.Close()
 
-	rows, err := f.GetRows("Sheet1")
+	sheet, err = nmapscan.SelectSheet(f.GetSheetList(), sheet)
+	if err != nil {
+		return nil, fmt.Errorf("选择工作表失败: %v", err)
+	}
+	rows, err := f.GetRows(sheet)
 	if err != nil {
 		return nil, fmt.Errorf("读取工作表失败: %v", err)
 	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("工作表 %s 为空", sheet)
+	}
+
+	// 第一行为表头
+	cols, err := nmapscan.MapColumns(rows[0], columns)
+	if err != nil {
+		return nil, fmt.Errorf("工作表 %s %v", sheet, err)
+	}
 
 	var infos []ExcelInfo
-	// 跳过表头 i:=0
-	//
-	//默认不处理第一行
-	//
 	for i := 1; i < len(rows); i++ {
 		row := rows[i]
-		// 修改判断逻辑：只要前三列有值就处理该行
-		if len(row) >= 3 && (row[0] != "" || row[1] != "" || row[2] != "") {
-			info := ExcelInfo{
-				Number: row[0],
-				Name:   row[1],
-				Domain: row[2],
-				IP:     "", // IP默认为空字符串
-				PORT:   "",
-				REMARK: "",
-			}
-			// 如果存在第四列（IP列）且不为空，则设置IP值
-			if len(row) >= 4 {
-				info.IP = row[3]
-			}
-			if len(row) >= 5 {
-				info.PORT = row[4]
-			}
-			if len(row) >= 8 {
-				info.REMARK = row[7]
-			}
-			infos = append(infos, info)
+		info := ExcelInfo{
+			Number: cols.Value(row, nmapscan.ColNumber),
+			Name:   cols.Value(row, nmapscan.ColName),
+			Domain: cols.Value(row, nmapscan.ColDomain),
+			IP:     cols.Value(row, nmapscan.ColIP),
+			PORT:   cols.Value(row, nmapscan.ColPort),
+			REMARK: cols.Value(row, nmapscan.ColRemark),
+		}
+		// 单位、名称、地址、IP都为空的行跳过
+		if info.Number == "" && info.Name == "" && info.Domain == "" && info.IP == "" {
+			continue
 		}
+		infos = append(infos, info)
 	}
 	return infos, nil
 }
 
-// 结果写入Excel
-func exportToExcel(results map[string]ScanResult, sourceInfos []ExcelInfo, filename string, append bool) error {
-	var f *excelize.File
-	var currentRow int
-
-	if append {
-		// 如果文件存在则打开，不存在则创建新文件
-		if _, statErr := os.Stat(filename); statErr == nil {
-			var openErr error
-			f, openErr = excelize.OpenFile(filename)
-			if openErr != nil {
-				return fmt.Errorf("打开Excel文件失败: %v", openErr)
-			}
-			// 获取最后一行的行号
-			rows, _ := f.GetRows("Sheet1")
-			currentRow = len(rows) + 1
-		} else {
-			f = excelize.NewFile()
-			currentRow = 2 // 新文件从第二行开始写入数据
-			// 写入表头
-			headers := []string{"所属单位", "网站名称", "网站地址", "IP", "端口", "协议", "应用", "操作系统", "备注", "操作系统猜测", "状态"}
-			for i, header := range headers {
-				cell, _ := excelize.CoordinatesToCellName(i+1, 1)
-				f.SetCellValue("Sheet1", cell, header)
-			}
-		}
-	} else {
-		f = excelize.NewFile()
-		currentRow = 2
-		// 写入表头
-		headers := []string{"所属单位", "网站名称", "网站地址", "IP", "端口", "协议", "应用", "操作系统", "备注", "操作系统猜测", "状态"}
-		for i, header := range headers {
-			cell, _ := excelize.CoordinatesToCellName(i+1, 1)
-			f.SetCellValue("Sheet1", cell, header)
-		}
-	}
+// 输出Excel的表头
+// Findings 工作表的表头，每条命中的规则一行
+var findingHeaders = []string{"风险等级", "规则", "风险发现", "所属单位", "网站名称", "网站地址", "IP", "端口", "协议(tcp)", "应用", "版本"}
+
+// Scripts 工作表的表头，每个脚本一行，主机级别脚本的端口为空
+var scriptHeaders = []string{"所属单位", "IP", "端口", "协议(tcp)", "脚本", "输出"}
+
+var outputHeaders = []string{"所属单位", "网站名称", "网站地址", "IP", "端口", "协议", "应用", "操作系统", "备注", "操作系统猜测", "状态", "协议(tcp)", "IP来源", "风险等级", "风险发现", "CVE", "最高CVSS", "网页标题", "证书", "主机状态", "延迟(ms)", "MAC地址", "MAC厂商", "反向DNS", "运行时间", "跳数", "路由跟踪"}
+
+// Excel定期保存的间隔，结束时总会保存
+const excelSaveInterval = 30 * time.Second
+
+// 结果Excel写入器。整个运行期间只打开一次工作簿，在内存中追加行，
+// 定期先写入临时文件再重命名覆盖，进程意外退出时不会留下损坏的文件
+type excelWriter struct {
+	f        *excelize.File
+	filename string
+	row      int
+	style    int
+	unsaved  int
+	lastSave time.Time
+	// Findings/Scripts 工作表的下一行，为0时表示工作表尚未创建
+	findingRow int
+	scriptRow  int
+	// 各风险等级的单元格样式
+	severityStyles map[string]int
+}
 
-	defer func() {
-		if err := f.Close(); err != nil {
-			fmt.Printf("关闭Excel文件时出错: %v\n", err)
-		}
-	}()
+// 创建结果Excel。续扫时由状态文件中已完成的行重新生成，不在旧文件后追加
+func openExcelWriter(filename string) (*excelWriter, error) {
+	w := &excelWriter{filename: filename, row: 2, lastSave: time.Now()}
+	w.f = excelize.NewFile()
+	// 写入表头
+	for i, header := range outputHeaders {
+		cell, _ := excelize.CoordinatesToCellName(i+1, 1)
+		w.f.SetCellValue("Sheet1", cell, header)
+	}
 
-	// 使用map存储IP对应的信息，方便查找
-	infoMap := make(map[string]ExcelInfo)
-	for _, info := range sourceInfos {
-		infoMap[info.IP] = info
+	// 更新列宽设置
+	columnWidths := map[int]float64{
+		1:  10, // 序号
+		2:  15, // 名称
+		3:  20, // 域名
+		4:  15, // IP地址
+		5:  10, // 端口
+		6:  20, // 协议
+		7:  25, // 应用
+		8:  25, // 操作系统
+		9:  20, // 备注
+		10: 10, // 操作系统猜测
+		11: 15, // 状态
+		12: 10, // 协议(tcp)
+		13: 20, // IP来源
+		14: 10, // 风险等级
+		15: 40, // 风险发现
+		16: 20, // CVE
+		17: 10, // 最高CVSS
+		18: 30, // 网页标题
+		19: 40, // 证书
+		20: 15, // 主机状态
+		21: 10, // 延迟(ms)
+		22: 18, // MAC地址
+		23: 20, // MAC厂商
+		24: 25, // 反向DNS
+		25: 20, // 运行时间
+		26: 8,  // 跳数
+		27: 30, // 路由跟踪
+	}
+	for col, width := range columnWidths {
+		colName, _ := excelize.ColumnNumberToName(col)
+		w.f.SetColWidth("Sheet1", colName, colName, width)
 	}
 
-	for ip, result := range results {
-		startRow := currentRow
-		info := infoMap[ip]
-		osInfo := " "
-		if len(result.OS) > 0 {
-			osInfo = strings.Join(result.OS, "\n")
+	// 合并单元格的样式
+	style, err := w.f.NewStyle(&excelize.Style{
+		Alignment: &excelize.Alignment{
+			Vertical: "center",
+			WrapText: true,
+		},
+	})
+	if err != nil {
+		w.f.Close()
+		return nil, err
+	}
+	w.style = style
+
+	// 风险等级按严重程度着色
+	w.severityStyles = make(map[string]int)
+	colors := map[string]string{"critical": "C00000", "high": "FFC7CE", "medium": "FFEB9C", "low": "DDEBF7", "info": "F2F2F2"}
+	for severity, color := range colors {
+		font := &excelize.Font{}
+		if severity == "critical" {
+			font.Color = "FFFFFF"
+			font.Bold = true
 		}
-
-		osGuessInfo := " "
-		if len(result.OSGuesses) > 0 {
-			osGuessInfo = strings.Join(result.OSGuesses, "\n")
+		style, err := w.f.NewStyle(&excelize.Style{
+			Fill: excelize.Fill{Type: "pattern", Color: []string{color}, Pattern: 1},
+			Font: font,
+		})
+		if err != nil {
+			w.f.Close()
+			return nil, err
 		}
+		w.severityStyles[severity] = style
+	}
 
-		if len(result.Ports) == 0 || ip == "" {
-			// 写入基本信息，其他字段留空
-			f.SetCellValue("Sheet1", fmt.Sprintf("A%d", currentRow), info.Number)
-			f.SetCellValue("Sheet1", fmt.Sprintf("B%d", currentRow), info.Name)
-			f.SetCellValue("Sheet1", fmt.Sprintf("C%d", currentRow), info.Domain)
-			f.SetCellValue("Sheet1", fmt.Sprintf("D%d", currentRow), ip)
-			f.SetCellValue("Sheet1", fmt.Sprintf("E%d", currentRow), "") // 端口为空
-			f.SetCellValue("Sheet1", fmt.Sprintf("F%d", currentRow), "") // 协议为空
-			f.SetCellValue("Sheet1", fmt.Sprintf("G%d", currentRow), "") // 应用为空
-			f.SetCellValue("Sheet1", fmt.Sprintf("H%d", currentRow), "") // 操作系统为空
-			f.SetCellValue("Sheet1", fmt.Sprintf("I%d", currentRow), "") // 备注为空
-			f.SetCellValue("Sheet1", fmt.Sprintf("J%d", currentRow), "") // 操作系统猜测为空
-			f.SetCellValue("Sheet1", fmt.Sprintf("K%d", currentRow), "") // 状态为空
-			f.SetCellValue("Sheet1", fmt.Sprintf("L%d", currentRow), "") // 协议(tcp)
-			currentRow++
-			continue
-		}
+	// 先保存一次，确保输出路径可写并在扫描开始前生成文件
+	if err := w.Save(); err != nil {
+		w.f.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// 写入单个IP的扫描结果，距上次保存超过 excelSaveInterval 时保存文件。
+// saved 表示本次写入后文件已保存，之前写入的结果都已在磁盘上
+func (w *excelWriter) Write(ip string, result ScanResult, info ExcelInfo) (saved bool, err error) {
+	f := w.f
+	currentRow := w.row
+	startRow := currentRow
+	osInfo := " "
+	if len(result.OS) > 0 {
+		osInfo = strings.Join(result.OS, "\n")
+	}
 
+	osGuessInfo := " "
+	if len(result.OSGuesses) > 0 {
+		osGuessInfo = strings.Join(result.OSGuesses, "\n")
+	}
+
+	if len(result.Ports) == 0 || ip == "" {
+		// 写入基本信息，其他字段留空
+		f.SetCellValue("Sheet1", fmt.Sprintf("A%d", currentRow), info.Number)
+		f.SetCellValue("Sheet1", fmt.Sprintf("B%d", currentRow), info.Name)
+		f.SetCellValue("Sheet1", fmt.Sprintf("C%d", currentRow), info.Domain)
+		f.SetCellValue("Sheet1", fmt.Sprintf("D%d", currentRow), ip)
+		f.SetCellValue("Sheet1", fmt.Sprintf("E%d", currentRow), "") // 端口为空
+		f.SetCellValue("Sheet1", fmt.Sprintf("F%d", currentRow), "") // 协议为空
+		f.SetCellValue("Sheet1", fmt.Sprintf("G%d", currentRow), "") // 应用为空
+		// 操作系统，扫描失败或中断时为原因
+		f.SetCellValue("Sheet1", fmt.Sprintf("H%d", currentRow), strings.Join(result.OS, "\n"))
+		f.SetCellValue("Sheet1", fmt.Sprintf("I%d", currentRow), "") // 备注为空
+		f.SetCellValue("Sheet1", fmt.Sprintf("J%d", currentRow), "") // 操作系统猜测为空
+		// 状态列说明主机离线还是在线但没有开放端口，或者为什么没有扫描
+		f.SetCellValue("Sheet1", fmt.Sprintf("K%d", currentRow), emptyRowState(info, result))
+		f.SetCellValue("Sheet1", fmt.Sprintf("L%d", currentRow), "") // 协议(tcp)
+		f.SetCellValue("Sheet1", fmt.Sprintf("M%d", currentRow), info.IPSource)
+		currentRow++
+	} else {
 		for _, port := range result.Ports {
 			f.SetCellValue("Sheet1", fmt.Sprintf("A%d", currentRow), info.Number)
 			f.SetCellValue("Sheet1", fmt.Sprintf("B%d", currentRow), info.Name)
@@ -268,186 +502,327 @@ func exportToExcel(results map[string]ScanResult, sourceInfos []ExcelInfo, filen
 			f.SetCellValue("Sheet1", fmt.Sprintf("D%d", currentRow), ip)
 			f.SetCellValue("Sheet1", fmt.Sprintf("E%d", currentRow), port.Port)
 			service := strings.TrimSuffix(port.Service, "?")
-			f.SetCellValue("Sheet1", fmt.Sprintf("F%d", currentRow), service)  //协议
-			f.SetCellValue("Sheet1", fmt.Sprintf("G%d", currentRow), port.Version)   //应用
-			f.SetCellValue("Sheet1", fmt.Sprintf("H%d", currentRow), osInfo) // 操作系统
-			f.SetCellValue("Sheet1", fmt.Sprintf("I%d", currentRow), info.REMARK)          // 备注列
+			f.SetCellValue("Sheet1", fmt.Sprintf("F%d", currentRow), service)      //协议
+			f.SetCellValue("Sheet1", fmt.Sprintf("G%d", currentRow), port.Version) //应用
+			f.SetCellValue("Sheet1", fmt.Sprintf("H%d", currentRow), osInfo)       // 操作系统
+			f.SetCellValue("Sheet1", fmt.Sprintf("I%d", currentRow), info.REMARK)  // 备注列
 			f.SetCellValue("Sheet1", fmt.Sprintf("J%d", currentRow), osGuessInfo)
 			f.SetCellValue("Sheet1", fmt.Sprintf("K%d", currentRow), port.State)
 			f.SetCellValue("Sheet1", fmt.Sprintf("L%d", currentRow), port.Protocol)
+			f.SetCellValue("Sheet1", fmt.Sprintf("M%d", currentRow), info.IPSource)
+			if severity := highestSeverity(port.Findings); severity != "" {
+				var texts []string
+				for _, fd := range port.Findings {
+					texts = append(texts, fd.Finding)
+				}
+				cell := fmt.Sprintf("N%d", currentRow)
+				f.SetCellValue("Sheet1", cell, severityNames[severity])
+				f.SetCellStyle("Sheet1", cell, cell, w.severityStyles[severity])
+				f.SetCellValue("Sheet1", fmt.Sprintf("O%d", currentRow), strings.Join(texts, "\n"))
+				if err := w.writeFindings(ip, info, port); err != nil {
+					return false, err
+				}
+			}
+			if len(port.CVEs) > 0 {
+				f.SetCellValue("Sheet1", fmt.Sprintf("P%d", currentRow), cveCellText(port.CVEs))
+				f.SetCellValue("Sheet1", fmt.Sprintf("Q%d", currentRow), port.CVSS)
+			}
+			f.SetCellValue("Sheet1", fmt.Sprintf("R%d", currentRow), port.HTTPTitle)
+			f.SetCellValue("Sheet1", fmt.Sprintf("S%d", currentRow), port.SSLCert)
 			currentRow++
 		}
+	}
+	w.writeHostInfo(startRow, result)
+
+	// 合并单元格时需要包含新的操作系统猜测列
+	if currentRow > startRow+1 {
+		cols := []string{"A", "B", "C", "D", "H", "I", "J", "M", "T", "U", "V", "W", "X", "Y", "Z", "AA"}
+		for _, col := range cols {
+			f.MergeCell("Sheet1", fmt.Sprintf("%s%d", col, startRow),
+				fmt.Sprintf("%s%d", col, currentRow-1))
+			f.SetCellStyle("Sheet1", fmt.Sprintf("%s%d", col, startRow),
+				fmt.Sprintf("%s%d", col, currentRow-1), w.style)
+		}
+	}
+	w.row = currentRow
 
-		// 合并单元格时需要包含新的操作系统猜测列
-		if currentRow > startRow+1 {
-			cols := []string{"A", "B", "C", "D", "H", "I", "J"}
-			for _, col := range cols {
-				f.MergeCell("Sheet1", fmt.Sprintf("%s%d", col, startRow),
-					fmt.Sprintf("%s%d", col, currentRow-1))
+	// 脚本输出写入 Scripts 工作表，先写主机级别的脚本
+	for _, s := range result.HostScripts {
+		if err := w.writeScript(info.Number, ip, "", "", s); err != nil {
+			return false, err
+		}
+	}
+	for _, port := range result.Ports {
+		for _, s := range port.Scripts {
+			if err := w.writeScript(info.Number, ip, port.Port, port.Protocol, s); err != nil {
+				return false, err
 			}
+		}
+	}
+	w.unsaved++
 
-			// 设置单元格样式，包括边框
-			style, _ := f.NewStyle(&excelize.Style{
-				Alignment: &excelize.Alignment{
-					Vertical: "center",
-					WrapText: true,
-				},
-				// Border: []excelize.Border{
-				// 	{Type: "left", Color: "000000", Style: 1},
-				// 	{Type: "top", Color: "000000", Style: 1},
-				// 	{Type: "bottom", Color: "000000", Style: 1},
-				// 	{Type: "right", Color: "000000", Style: 1},
-				// },
-			})
-			for _, col := range cols {
-				f.SetCellStyle("Sheet1", fmt.Sprintf("%s%d", col, startRow),
-					fmt.Sprintf("%s%d", col, currentRow-1), style)
-			}
+	if time.Since(w.lastSave) < excelSaveInterval {
+		return false, nil
+	}
+	if err := w.Save(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// 主机信息写入第一行的 T-AA 列，多个端口时与其他主机级别的列一起合并
+func (w *excelWriter) writeHostInfo(row int, result ScanResult) {
+	values := []interface{}{
+		hostStateCell(result),
+		"",
+		result.MAC,
+		result.MACVendor,
+		result.RDNS,
+		uptimeText(result),
+		"",
+		hopsText(result.Hops),
+	}
+	if result.Latency > 0 {
+		values[1] = latencyMillis(result.Latency)
+	}
+	if result.Distance > 0 {
+		values[6] = result.Distance
+	}
+	w.f.SetSheetRow("Sheet1", fmt.Sprintf("T%d", row), &values)
+}
+
+// 在 Findings 工作表中为端口命中的每条规则写入一行
+func (w *excelWriter) writeFindings(ip string, info ExcelInfo, port PortInfo) error {
+	if w.findingRow == 0 {
+		if err := w.newSheet("Findings", findingHeaders); err != nil {
+			return err
 		}
+		w.f.SetColWidth("Findings", "A", "B", 12)
+		w.f.SetColWidth("Findings", "C", "C", 40)
+		w.f.SetColWidth("Findings", "D", "K", 15)
+		w.findingRow = 2
+	}
+	for _, fd := range port.Findings {
+		cell, _ := excelize.CoordinatesToCellName(1, w.findingRow)
+		w.f.SetSheetRow("Findings", cell, &[]interface{}{
+			severityNames[fd.Severity], fd.Rule, fd.Finding, info.Number, info.Name, info.Domain,
+			ip, port.Port, port.Protocol, strings.TrimSuffix(port.Service, "?"), port.Version,
+		})
+		w.f.SetCellStyle("Findings", cell, cell, w.severityStyles[fd.Severity])
+		w.findingRow++
 	}
+	return nil
+}
 
-	// 更新列宽设置
-	columnWidths := map[int]float64{
-		1:  10, // 序号
-		2:  15, // 名称
-		3:  20, // 域名
-		4:  15, // IP地址
-		5:  10, // 端口
-		6:  20, // 协议
-		7:  25, // 应用
-		8:  25, // 操作系统
-		9:  20, // 备注
-		10: 10, // 操作系统猜测
-		11: 15, // 状态
-		12: 10, // 协议(tcp)
+// 在 Scripts 工作表中写入一个脚本的输出
+func (w *excelWriter) writeScript(org, ip, port, protocol string, s ScriptOutput) error {
+	if w.scriptRow == 0 {
+		if err := w.newSheet("Scripts", scriptHeaders); err != nil {
+			return err
+		}
+		w.f.SetColWidth("Scripts", "A", "B", 15)
+		w.f.SetColWidth("Scripts", "C", "D", 8)
+		w.f.SetColWidth("Scripts", "E", "E", 20)
+		w.f.SetColWidth("Scripts", "F", "F", 80)
+		w.scriptRow = 2
 	}
+	cell, _ := excelize.CoordinatesToCellName(1, w.scriptRow)
+	w.f.SetSheetRow("Scripts", cell, &[]interface{}{org, ip, port, protocol, s.ID, truncateCell(s.Output)})
+	w.f.SetCellStyle("Scripts", fmt.Sprintf("F%d", w.scriptRow), fmt.Sprintf("F%d", w.scriptRow), w.style)
+	w.scriptRow++
+	return nil
+}
 
-	for col, width := range columnWidths {
-		colName, _ := excelize.ColumnNumberToName(col)
-		f.SetColWidth("Sheet1", colName, colName, width)
+// 创建工作表并写入表头
+func (w *excelWriter) newSheet(name string, headers []string) error {
+	if _, err := w.f.NewSheet(name); err != nil {
+		return fmt.Errorf("创建%s工作表失败: %v", name, err)
+	}
+	return w.f.SetSheetRow(name, "A1", &headers)
+}
+
+// 保存到临时文件后重命名覆盖目标文件
+func (w *excelWriter) Save() error {
+	tmp, err := os.CreateTemp(filepath.Dir(w.filename), filepath.Base(w.filename)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("保存Excel文件失败: %v", err)
 	}
+	defer os.Remove(tmp.Name())
 
-	return f.SaveAs(filename)
+	if _, err := w.f.WriteTo(tmp); err != nil {
+		tmp.Close()
+		return fmt.Errorf("保存Excel文件失败: %v", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("保存Excel文件失败: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("保存Excel文件失败: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), w.filename); err != nil {
+		return fmt.Errorf("保存Excel文件失败: %v", err)
+	}
+	w.unsaved = 0
+	w.lastSave = time.Now()
+	return nil
 }
 
-// 写入单个IP的扫描结果
-func appendScanResult(ip string, result ScanResult, info ExcelInfo, filename string) error {
-	singleResult := make(map[string]ScanResult)
-	singleResult[ip] = result
+// 保存未保存的结果并关闭工作簿
+func (w *excelWriter) Close() error {
+	if w == nil {
+		return nil
+	}
+	var err error
+	if w.unsaved > 0 {
+		err = w.Save()
+	}
+	if closeErr := w.f.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("关闭Excel文件时出错: %v", closeErr)
+	}
+	return err
+}
 
-	singleInfo := []ExcelInfo{info}
-	return exportToExcel(singleResult, singleInfo, filename, true)
+// 按 -scanner 选择扫描方式，auto 时本机没有nmap则使用connect扫描
+func selectScanner(mode string, recordDir string, connect *nmapscan.ConnectScanner) (nmapscan.Scanner, error) {
+	switch mode {
+	case "nmap":
+		return &nmapscan.ExecScanner{RecordDir: recordDir}, nil
+	case "auto", "":
+		if nmapscan.NmapAvailable("") {
+			return &nmapscan.ExecScanner{RecordDir: recordDir}, nil
+		}
+		logf("未找到nmap，")
+	case "connect":
+	default:
+		return nil, fmt.Errorf("未知的扫描方式: %s，可选 auto、nmap、connect", mode)
+	}
+	logf("使用内置的TCP connect扫描，只得到端口状态，nmap参数中除端口(-p、--top-ports、-F)和 -Pn 外的选项不生效\n")
+	if recordDir != "" {
+		logf("警告: -record 只在使用nmap时有效\n")
+	}
+	return connect, nil
 }
 
+// 扫描被中断时的退出码，与shell中被SIGINT结束的进程相同，便于定时任务和脚本区分
+const exitInterrupted = 130
+
 func main() {
+	// 子命令
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "history":
+			runHistory(os.Args[2:])
+			return
+		case "diff":
+			runDiff(os.Args[2:])
+			return
+		case "schedule":
+			runSchedule(os.Args[2:])
+			return
+		case "import-nvd":
+			runImportNVD(os.Args[2:])
+			return
+		}
+	}
+
 	// 添加新的命令行参数
 	sourceExcel := flag.String("s", "", "源Excel文件路径")
 	filePath := flag.String("f", "", "包含IP列表的文件路径")
 	ipList := flag.String("i", "", "IP地址列表，用逗号分隔")
-	nmapArgs := flag.String("a", "-sV -O -Pn --host-timeout 58m -p 1-65535", "nmap扫描参数")
+	nmapArgs := flag.String("a", defaultNmapArgs, "nmap扫描参数")
 	excelOutput := flag.String("e", "", "输出结果到Excel文件")
+	concurrency := flag.Int("c", 1, "同时运行的nmap进程数")
+	batchSize := flag.Int("batch", 1, "每个nmap进程扫描的主机数，大于1时多个主机通过 -iL 交给一个nmap进程")
+	resume := flag.Bool("resume", false, "根据状态文件跳过已完成的行，继续写入已有的Excel文件")
+	resolveDomain := flag.Bool("resolve", false, "对没有IP的行解析网站地址(A/AAAA)后扫描")
+	outputFormats := flag.String("o", "", "额外的输出格式，可选 json、ndjson、csv，多个用逗号分隔")
+	outputBase := flag.String("out", "", "-o 输出文件的路径(不含扩展名)，默认与 -e 相同，未指定 -e 时为 scan_result")
+	dbPath := flag.String("db", "", "将扫描结果记录到SQLite历史数据库，可用 history 子命令查询")
+	dnsServer := flag.String("dns", "", "解析域名使用的DNS服务器，如 114.114.114.114 或 127.0.0.1:5353，默认使用系统配置")
+	sheet := flag.String("sheet", "", "源Excel的工作表名称或序号(从1开始)，默认为 Sheet1 或第一个工作表")
+	columnAliases := flag.String("columns", "", "源Excel的列别名，如 \"ip=主机IP|目标地址;remark=说明\"")
+	cvePath := flag.String("cve", "", "本地漏洞库路径(由 import-nvd 子命令导入)，为端口匹配CVE")
+	htmlOutput := flag.String("html", "", "输出HTML报告，单个文件，不依赖外部资源")
+	policyFile := flag.String("policy", "", "风险规则文件(YAML)，命中的端口写入风险等级、风险发现列和 Findings 工作表")
+	replayDir := flag.String("replay", "", "不执行nmap，从该目录读取录制的XML结果(<IP>.xml)，用于离线测试")
+	recordDir := flag.String("record", "", "将每个目标的nmap XML结果保存到该目录，供 -replay 使用")
+	scannerMode := flag.String("scanner", "auto", "扫描方式: auto(有nmap时使用nmap，否则使用内置的TCP connect扫描)、nmap、connect")
+	connectWorkers := flag.Int("connect-workers", 100, "connect扫描时每个主机同时进行的连接数")
+	connectTimeout := flag.Duration("connect-timeout", 2*time.Second, "connect扫描时单次连接的超时时间")
+	connectRetries := flag.Int("connect-retries", 1, "connect扫描时连接超时后的重试次数")
+	twoPhase := flag.Bool("two-phase", false, "分阶段扫描: 先用 -discover-args 快速发现开放端口，再只对这些端口执行 -a 中的参数")
+	discoverArgs := flag.String("discover-args", defaultDiscoverArgs, "分阶段扫描时第一阶段(端口发现)的nmap参数")
+	discoverMode := flag.String("discover-scanner", "", "分阶段扫描时第一阶段的扫描方式(auto、nmap、connect)，默认与 -scanner 相同")
+	scopeFile := flag.String("scope", "", "授权范围文件(YAML)，只扫描 allow 中的网段和域名，exclude 中的目标始终不扫描")
+	dryRun := flag.Bool("dry-run", false, "等同于 -plan")
+	plan := flag.Bool("plan", false, "输出扫描计划: 每行是否扫描及原因、将执行的nmap命令、探测数和最坏情况耗时，不执行扫描")
+	planOutput := flag.String("plan-out", "", "-plan 时将扫描计划另存为CSV文件")
 	flag.Parse()
 
-	var ips []string
-	var sourceInfos []ExcelInfo
-	var err error
-
-	// 从Excel文件读取信息
-	if *sourceExcel != "" {
-		sourceInfos, err = readExcel(*sourceExcel)
-		if err != nil {
-			fmt.Printf("读取Excel文件失败: %v\n", err)
-			return
-		}
-		// 只提取有IP的行到IP列表，但保留所有sourceInfos
-		for _, info := range sourceInfos {
-			if info.IP != "" && info.PORT == "" {
-				ips = append(ips, info.IP)
-			}
-		}
+	var scanner, discoverScanner nmapscan.Scanner
+	if *replayDir != "" {
+		scanner = &nmapscan.ReplayScanner{Dir: *replayDir}
 	} else {
-		// 原有的IP列表读取逻辑保持不变
-		// 从文件读取IP
-		if *filePath != "" {
-			file, err := os.Open(*filePath)
-			if err != nil {
-				fmt.Printf("无法打开文件: %v\n", err)
-				return
-			}
-			defer file.Close()
-
-			scanner := bufio.NewScanner(file)
-			for scanner.Scan() {
-				if ip := strings.TrimSpace(scanner.Text()); ip != "" {
-					ips = append(ips, ip)
-				}
-			}
-		} else if *ipList != "" {
-			// 从命令行参数获取IP
-			for _, ip := range strings.Split(*ipList, ",") {
-				if ip := strings.TrimSpace(ip); ip != "" {
-					ips = append(ips, ip)
-				}
-			}
-		} else {
-			fmt.Println("请提供扫描内容")
-			return
+		connect := &nmapscan.ConnectScanner{Concurrency: *connectWorkers, Timeout: *connectTimeout, Retries: *connectRetries}
+		var err error
+		scanner, err = selectScanner(*scannerMode, *recordDir, connect)
+		if err == nil && *twoPhase && *discoverMode != "" {
+			discoverScanner, err = selectScanner(*discoverMode, "", connect)
 		}
-	}
-
-	// 创建一个空的Excel文件
-	if *excelOutput != "" {
-		emptyResults := make(map[string]ScanResult)
-		if err := exportToExcel(emptyResults, nil, *excelOutput, false); err != nil {
-			fmt.Printf("创建Excel文件时出错: %v\n", err)
-			return
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			os.Exit(1)
 		}
 	}
 
-	var totalDuration time.Duration
-	// 按照源Excel的顺序处理所有记录
-	if *sourceExcel != "" {
-		for _, info := range sourceInfos {
-			if info.IP == "" {
-				// 对于没有IP的记录，直接写入空结果
-				if *excelOutput != "" {
-					if err := appendScanResult("", ScanResult{}, info, *excelOutput); err != nil {
-						fmt.Printf("写入无IP记录时出错: %v\n", err)
-					}
-				}
-			}else{
-				// 对没有端口信息的IP进行扫描
-				fmt.Printf("正在扫描 %s...\n", info.IP)
-				result, duration, err := scanIP(info.IP, *nmapArgs)
-				if err != nil {
-					fmt.Printf("扫描 %s 时出错: %v\n", info.IP, err)
-					if *excelOutput != "" {
-						failedResult := ScanResult{
-							OS:    []string{"扫描失败: " + err.Error()},
-							Ports: []PortInfo{},
-						}
-						if err := appendScanResult(info.IP, failedResult, info, *excelOutput); err != nil {
-							fmt.Printf("写入 %s 的失败结果时出错: %v\n", info.IP, err)
-						}
-					}
-					continue
-				}
-
-				if *excelOutput != "" {
-					if err := appendScanResult(info.IP, result, info, *excelOutput); err != nil {
-						fmt.Printf("写入 %s 的扫描结果时出错: %v\n", info.IP, err)
-					} else {
-						fmt.Printf("%s 的扫描结果已写入文件\n", info.IP)
-					}
-				}
-				totalDuration += duration
-			}
-		}
-	} else {
-		// 处理从文件或命令行参数读取的IP列表
-		// ... 原有的IP列表处理代码 ...
+	opts := batchOptions{
+		SourceExcel:   *sourceExcel,
+		Sheet:         *sheet,
+		ColumnAliases: *columnAliases,
+		FilePath:      *filePath,
+		IPList:        *ipList,
+		NmapArgs:      *nmapArgs,
+		ExcelOutput:   *excelOutput,
+		Concurrency:   *concurrency,
+		Resume:        *resume,
+		ResolveDomain: *resolveDomain,
+		DNSServer:     *dnsServer,
+		OutputFormats: *outputFormats,
+		OutputBase:    *outputBase,
+		DBPath:        *dbPath,
+		PolicyFile:    *policyFile,
+		HTMLOutput:    *htmlOutput,
+		CVEDB:         *cvePath,
+		Scanner:       scanner,
+		TwoPhase:      *twoPhase,
+		DiscoverArgs:  *discoverArgs,
+		BatchSize:     *batchSize,
+		ScopeFile:     *scopeFile,
+		Plan:          *plan || *dryRun || *planOutput != "",
+		PlanOutput:    *planOutput,
 	}
+	opts.DiscoverScanner = discoverScanner
+
+	// 第一次收到中断信号时停止扫描并保存已有结果，第二次强制退出
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		logf("\n收到中断信号，正在停止扫描并保存已有结果，再次中断将强制退出\n")
+		cancel()
+		<-sigs
+		logf("强制退出\n")
+		os.Exit(exitInterrupted)
+	}()
 
-	fmt.Printf("\n所有扫描结果已保存到Excel文件: %s\n", *excelOutput)
-	fmt.Printf("总耗时: %s\n", totalDuration)
+	if err := runBatch(ctx, opts); err != nil {
+		fmt.Printf("%v\n", err)
+		os.Exit(1)
+	}
+	if ctx.Err() != nil {
+		os.Exit(exitInterrupted)
+	}
 }
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	nmapscan "github.com/helar52-xl/batch_scan_ip_base_nmap/nmap_scan"
+)
+
+// 返回固定结果的批量扫描，interrupt不为空时模拟扫描过程中收到中断信号
+type fakeBatchScanner struct {
+	run       *nmapscan.Run
+	err       error
+	interrupt context.CancelFunc
+}
+
+func (s *fakeBatchScanner) Scan(ctx context.Context, target string, opts nmapscan.Options) (*nmapscan.Run, error) {
+	return s.ScanBatch(ctx, []string{target}, opts)
+}
+
+func (s *fakeBatchScanner) ScanBatch(ctx context.Context, targets []string, opts nmapscan.Options) (*nmapscan.Run, error) {
+	if s.interrupt != nil {
+		s.interrupt()
+	}
+	return s.run, s.err
+}
+
+func TestScanIPs(t *testing.T) {
+	// 192.0.2.10 的录制结果在第一个主机之后截断，相当于nmap被中断
+	data, err := os.ReadFile(filepath.Join("testdata", "replay", "192.0.2.10.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	partial, err := nmapscan.ParsePartialXML(data[:strings.Index(string(data), "</host>")+len("</host>")])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ips := []string{"192.0.2.10", "192.0.2.11"}
+	type hostWant struct {
+		state string // HostState
+		ports int
+		err   string // 为空表示没有错误
+	}
+	tests := []struct {
+		name      string
+		scanner   func(cancel context.CancelFunc) nmapscan.BatchScanner
+		want      []hostWant
+		nmapStart bool // 第一个主机使用nmap记录的开始时间
+	}{
+		{
+			name: "离线主机不在XML中",
+			scanner: func(context.CancelFunc) nmapscan.BatchScanner {
+				return &nmapscan.ReplayScanner{Dir: filepath.Join("testdata", "replay")}
+			},
+			want:      []hostWant{{state: hostUp, ports: 2}, {state: hostDown}},
+			nmapStart: true,
+		},
+		{
+			name: "扫描被中断",
+			scanner: func(cancel context.CancelFunc) nmapscan.BatchScanner {
+				return &fakeBatchScanner{run: partial, err: errors.New("signal: interrupt"), interrupt: cancel}
+			},
+			want:      []hostWant{{state: hostUp, ports: 2}, {err: "扫描被中断"}},
+			nmapStart: true,
+		},
+		{
+			name: "nmap执行失败",
+			scanner: func(context.CancelFunc) nmapscan.BatchScanner {
+				return &fakeBatchScanner{err: errors.New("exit status 1")}
+			},
+			want: []hostWant{{err: "扫描错误: exit status 1"}, {err: "扫描错误: exit status 1"}},
+		},
+	}
+	for _, tt := range tests {
+		ctx, cancel := context.WithCancel(context.Background())
+		scans := scanIPs(ctx, tt.scanner(cancel), ips, nmapscan.Options{})
+		cancel()
+		if len(scans) != len(ips) {
+			t.Fatalf("%s: %d 个结果，应为 %d 个", tt.name, len(scans), len(ips))
+		}
+		for i, w := range tt.want {
+			scan := scans[i]
+			if scan.result.HostState != w.state || len(scan.result.Ports) != w.ports {
+				t.Errorf("%s: %s 状态 %q 端口 %d 个，应为 %q、%d 个", tt.name, ips[i], scan.result.HostState, len(scan.result.Ports), w.state, w.ports)
+			}
+			if (w.err == "") != (scan.err == nil) || (scan.err != nil && !strings.Contains(scan.err.Error(), w.err)) {
+				t.Errorf("%s: %s 的错误 %v，应包含 %q", tt.name, ips[i], scan.err, w.err)
+			}
+		}
+		if tt.nmapStart {
+			if want := time.Unix(1792030323, 0); !scans[0].start.Equal(want) || scans[0].duration != 18*time.Second {
+				t.Errorf("%s: 开始时间 %v 耗时 %v，应为nmap记录的 %v、18s", tt.name, scans[0].start, scans[0].duration, want)
+			}
+		}
+	}
+}
+
+func TestResultFromHost(t *testing.T) {
+	run, err := nmapscan.ParseXML([]byte(`<nmaprun scanner="nmap" args="nmap -sV -O 10.0.0.1 10.0.0.2" version="7.94">
+<host><status state="up" reason="echo-reply"/><address addr="10.0.0.1" addrtype="ipv4"/>
+<ports>
+<port protocol="tcp" portid="443"><state state="open" reason="syn-ack"/><service name="http" product="Microsoft IIS httpd" version="10.0" extrainfo="Windows Server 2016" tunnel="ssl"><cpe>cpe:/a:microsoft:internet_information_services:10.0</cpe></service></port>
+<port protocol="tcp" portid="3389"><state state="open" reason="syn-ack"/><service name="tcpwrapped"/></port>
+</ports>
+<os><osmatch name="Microsoft Windows Server 2016" accuracy="100"/><osmatch name="Microsoft Windows 10 1607" accuracy="93"/></os>
+</host>
+<host><status state="up" reason="syn-ack"/><address addr="10.0.0.2" addrtype="ipv4"/>
+<ports><extraports state="filtered" count="1000"/></ports>
+</host>
+</nmaprun>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := resultFromHost(run.Hosts[0], run.Meta())
+	want := []PortInfo{
+		// 多个单词的产品名和版本分别保存，版本列与nmap普通输出一致
+		{Port: "443", Protocol: "tcp", State: "open", Service: "ssl/http", Version: "Microsoft IIS httpd 10.0 (Windows Server 2016)",
+			Product: "Microsoft IIS httpd", ProductVersion: "10.0", ExtraInfo: "Windows Server 2016",
+			CPE: []string{"cpe:/a:microsoft:internet_information_services:10.0"}},
+		// tcpwrapped 只有服务名
+		{Port: "3389", Protocol: "tcp", State: "open", Service: "tcpwrapped"},
+	}
+	if len(result.Ports) != len(want) {
+		t.Fatalf("%d 个端口，应为 %d 个", len(result.Ports), len(want))
+	}
+	for i, w := range want {
+		got := result.Ports[i]
+		got.Scripts = nil
+		if !reflect.DeepEqual(got, w) {
+			t.Errorf("端口 %s = %+v，应为 %+v", w.Port, got, w)
+		}
+	}
+	if !reflect.DeepEqual(result.OS, []string{"Microsoft Windows Server 2016"}) || !reflect.DeepEqual(result.OSGuesses, []string{"Microsoft Windows 10 1607 (93%)"}) {
+		t.Errorf("操作系统 %q，猜测 %q", result.OS, result.OSGuesses)
+	}
+	if result.Meta.Args != run.Args {
+		t.Errorf("Meta.Args = %q", result.Meta.Args)
+	}
+
+	// 没有端口的主机: 端口为空，状态列说明汇总
+	result = resultFromHost(run.Hosts[1], run.Meta())
+	if result.Ports == nil || len(result.Ports) != 0 || len(result.OS) != 0 {
+		t.Errorf("没有端口的主机 端口 %+v 操作系统 %q", result.Ports, result.OS)
+	}
+	if text := hostStateText(result); text != "无开放端口(1000个filtered)" {
+		t.Errorf("hostStateText = %q", text)
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	nmapscan "github.com/helar52-xl/batch_scan_ip_base_nmap/nmap_scan"
+	"github.com/robfig/cron/v3"
+)
+
+// 定时任务配置文件
+type scheduleConfig struct {
+	// 运行记录文件(JSON Lines)，默认为配置文件旁的 schedule_history.jsonl
+	History string        `json:"history"`
+	Jobs    []scheduleJob `json:"jobs"`
+}
+
+// 单个定时任务，Output 和 HTML 中的 {time} 会替换为运行时间，
+// 不含 {time} 时在扩展名前加上时间
+type scheduleJob struct {
+	Name        string `json:"name"`
+	Source      string `json:"source"`
+	Sheet       string `json:"sheet"`
+	Columns     string `json:"columns"`
+	NmapArgs    string `json:"nmap_args"`
+	Cron        string `json:"cron"`
+	Output      string `json:"output"`
+	Concurrency int    `json:"concurrency"`
+	Formats     string `json:"formats"`
+	DB          string `json:"db"`
+	Resolve     bool   `json:"resolve"`
+	Policy      string `json:"policy"`
+	HTML        string `json:"html"`
+	CVE         string `json:"cve"`
+	// 分阶段扫描，DiscoverArgs 为空时使用 defaultDiscoverArgs
+	TwoPhase     bool   `json:"two_phase"`
+	DiscoverArgs string `json:"discover_args"`
+	BatchSize    int    `json:"batch_size"`
+	// 授权范围文件，见 -scope
+	Scope string `json:"scope"`
+}
+
+// 一次定时运行的记录
+type scheduleRun struct {
+	Job    string    `json:"job"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	Status string    `json:"status"` // success / failed / skipped / cancelled
+	Output string    `json:"output,omitempty"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// 默认的nmap参数，与 -a 一致
+const defaultNmapArgs = "-sV -O -Pn --host-timeout 58m -p 1-65535"
+
+// 分阶段扫描第一阶段的默认参数，不做服务识别，只快速找出开放的端口。
+// 不指定扫描类型，nmap有root权限时使用 -sS，否则使用 -sT
+const defaultDiscoverArgs = "-Pn -n -T4 --min-rate 5000 --max-retries 2 -p 1-65535"
+
+func loadScheduleConfig(filename string) (*scheduleConfig, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("读取配置文件失败: %v", err)
+	}
+	var config scheduleConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("解析配置文件失败: %v", err)
+	}
+	if len(config.Jobs) == 0 {
+		return nil, errors.New("配置文件中没有任务")
+	}
+
+	names := make(map[string]bool)
+	for i, job := range config.Jobs {
+		if job.Name == "" || job.Source == "" || job.Cron == "" || job.Output == "" {
+			return nil, fmt.Errorf("第%d个任务缺少 name/source/cron/output", i+1)
+		}
+		if names[job.Name] {
+			return nil, fmt.Errorf("任务名称重复: %s", job.Name)
+		}
+		names[job.Name] = true
+		// 与调度器使用的解析方式相同: 标准5段cron表达式或 @daily 等写法
+		if _, err := cron.ParseStandard(job.Cron); err != nil {
+			return nil, fmt.Errorf("任务 %s 的cron表达式无效: %v", job.Name, err)
+		}
+		if job.NmapArgs == "" {
+			config.Jobs[i].NmapArgs = defaultNmapArgs
+		}
+		if _, _, err := nmapscan.ParseArgs(config.Jobs[i].NmapArgs); err != nil {
+			return nil, fmt.Errorf("任务 %s: %v", job.Name, err)
+		}
+		if job.DiscoverArgs == "" {
+			config.Jobs[i].DiscoverArgs = defaultDiscoverArgs
+		}
+		if _, _, err := nmapscan.ParseArgs(config.Jobs[i].DiscoverArgs); err != nil {
+			return nil, fmt.Errorf("任务 %s 的端口发现参数: %v", job.Name, err)
+		}
+	}
+	if config.History == "" {
+		config.History = filepath.Join(filepath.Dir(filename), "schedule_history.jsonl")
+	}
+	return &config, nil
+}
+
+// 生成带时间的输出文件名
+func timestampedOutput(output string, t time.Time) string {
+	stamp := t.Format("20060102-150405")
+	if strings.Contains(output, "{time}") {
+		return strings.ReplaceAll(output, "{time}", stamp)
+	}
+	ext := filepath.Ext(output)
+	return strings.TrimSuffix(output, ext) + "_" + stamp + ext
+}
+
+// 定时任务调度器，同一任务上一次运行未结束时跳过本次运行
+type scheduler struct {
+	ctx     context.Context
+	history string
+
+	mu      sync.Mutex
+	running map[string]bool
+}
+
+func (s *scheduler) run(job scheduleJob) {
+	s.mu.Lock()
+	if s.running[job.Name] {
+		s.mu.Unlock()
+		logf("[%s] 上一次运行尚未结束，跳过本次运行\n", job.Name)
+		s.record(scheduleRun{Job: job.Name, Start: time.Now(), End: time.Now(), Status: "skipped"})
+		return
+	}
+	s.running[job.Name] = true
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.running, job.Name)
+		s.mu.Unlock()
+	}()
+
+	start := time.Now()
+	output := timestampedOutput(job.Output, start)
+	html := ""
+	if job.HTML != "" {
+		html = timestampedOutput(job.HTML, start)
+	}
+	if dir := filepath.Dir(output); dir != "" {
+		os.MkdirAll(dir, 0755)
+	}
+	logf("[%s] 开始运行，输出到 %s\n", job.Name, output)
+
+	err := runBatch(s.ctx, batchOptions{
+		SourceExcel:   job.Source,
+		Sheet:         job.Sheet,
+		ColumnAliases: job.Columns,
+		NmapArgs:      job.NmapArgs,
+		ExcelOutput:   output,
+		Concurrency:   job.Concurrency,
+		ResolveDomain: job.Resolve,
+		OutputFormats: job.Formats,
+		DBPath:        job.DB,
+		PolicyFile:    job.Policy,
+		HTMLOutput:    html,
+		CVEDB:         job.CVE,
+		TwoPhase:      job.TwoPhase,
+		DiscoverArgs:  job.DiscoverArgs,
+		BatchSize:     job.BatchSize,
+		ScopeFile:     job.Scope,
+	})
+
+	run := scheduleRun{Job: job.Name, Start: start, End: time.Now(), Status: "success", Output: output}
+	switch {
+	case err != nil:
+		run.Status = "failed"
+		run.Error = err.Error()
+		logf("[%s] 运行失败: %v\n", job.Name, err)
+	case s.ctx.Err() != nil:
+		run.Status = "cancelled"
+		logf("[%s] 运行被中断\n", job.Name)
+	default:
+		logf("[%s] 运行完成，耗时 %s\n", job.Name, run.End.Sub(start).Round(time.Second))
+	}
+	s.record(run)
+}
+
+// 追加一条运行记录
+func (s *scheduler) record(run scheduleRun) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := json.Marshal(run)
+	if err != nil {
+		return
+	}
+	f, err := os.OpenFile(s.history, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		logf("写入运行记录失败: %v\n", err)
+		return
+	}
+	defer f.Close()
+	f.Write(append(data, '\n'))
+}
+
+// schedule 子命令: 按配置文件中的cron表达式定时运行扫描
+func runSchedule(args []string) {
+	fs := flag.NewFlagSet("schedule", flag.ExitOnError)
+	configPath := fs.String("config", "schedule.json", "定时任务配置文件")
+	fs.Parse(args)
+
+	config, err := loadScheduleConfig(*configPath)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := &scheduler{ctx: ctx, history: config.History, running: make(map[string]bool)}
+
+	// 标准5段cron表达式(分 时 日 月 周)，也支持 @daily 等写法
+	c := cron.New()
+	for _, job := range config.Jobs {
+		job := job
+		if _, err := c.AddFunc(job.Cron, func() { s.run(job) }); err != nil {
+			fmt.Printf("任务 %s 的cron表达式无效: %v\n", job.Name, err)
+			return
+		}
+		logf("已加载任务 %s: %s\n", job.Name, job.Cron)
+	}
+	c.Start()
+	logf("定时扫描已启动，运行记录保存在 %s\n", config.History)
+
+	// 收到中断信号时停止调度，等待正在运行的任务保存结果后退出
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	<-sigs
+	logf("\n收到中断信号，正在停止正在运行的任务，再次中断将强制退出\n")
+	cancel()
+	go func() {
+		<-sigs
+		logf("强制退出\n")
+		os.Exit(1)
+	}()
+	<-c.Stop().Done()
+}
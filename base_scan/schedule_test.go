@@ -0,0 +1,79 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeScheduleConfig(t *testing.T, content string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "schedule.json")
+	if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestLoadScheduleConfig(t *testing.T) {
+	file := writeScheduleConfig(t, `{"jobs": [
+		{"name": "月度", "source": "input.xlsx", "cron": "0 2 1 * *", "output": "results/monthly_{time}.xlsx"},
+		{"name": "每天", "source": "input.xlsx", "cron": "@every 12h", "output": "daily.xlsx", "nmap_args": "-sV -p 80,443"}
+	]}`)
+	config, err := loadScheduleConfig(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 未指定时使用默认参数，运行记录在配置文件旁
+	if job := config.Jobs[0]; job.NmapArgs != defaultNmapArgs || job.DiscoverArgs != defaultDiscoverArgs {
+		t.Errorf("默认参数 %q / %q", job.NmapArgs, job.DiscoverArgs)
+	}
+	if config.Jobs[1].NmapArgs != "-sV -p 80,443" {
+		t.Errorf("nmap_args = %q", config.Jobs[1].NmapArgs)
+	}
+	if want := filepath.Join(filepath.Dir(file), "schedule_history.jsonl"); config.History != want {
+		t.Errorf("history = %q，应为 %q", config.History, want)
+	}
+
+	const job = `"name": "a", "source": "input.xlsx", "output": "out.xlsx"`
+	tests := []struct {
+		content string
+		err     string
+	}{
+		{`{"jobs": [{` + job + `, "cron": "0 2 * *"}]}`, "任务 a 的cron表达式无效"},
+		{`{"jobs": [{` + job + `, "cron": "61 * * * *"}]}`, "任务 a 的cron表达式无效"},
+		{`{"jobs": [{` + job + `, "cron": "@fortnightly"}]}`, "任务 a 的cron表达式无效"},
+		{`{"jobs": [{"name": "a", "source": "input.xlsx", "cron": "@daily"}]}`, "第1个任务缺少"},
+		{`{"jobs": [{` + job + `, "cron": "@daily"}, {` + job + `, "cron": "@weekly"}]}`, "任务名称重复: a"},
+		{`{"jobs": [{` + job + `, "cron": "@daily", "nmap_args": "-sV -p '80"}]}`, "任务 a:"},
+		{`{"jobs": [{` + job + `, "cron": "@daily", "discover_args": "-p \"1-100"}]}`, "任务 a 的端口发现参数"},
+		{`{"jobs": []}`, "没有任务"},
+		{`{"jobs": [`, "解析配置文件失败"},
+	}
+	for _, tt := range tests {
+		_, err := loadScheduleConfig(writeScheduleConfig(t, tt.content))
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("loadScheduleConfig(%s) 错误 %v，应包含 %q", tt.content, err, tt.err)
+		}
+	}
+}
+
+func TestTimestampedOutput(t *testing.T) {
+	start := time.Date(2026, 10, 1, 2, 0, 5, 0, time.Local)
+	tests := []struct {
+		output, want string
+	}{
+		{"results/monthly_{time}.xlsx", "results/monthly_20261001-020005.xlsx"},
+		{"{time}/report_{time}.html", "20261001-020005/report_20261001-020005.html"},
+		// 不含 {time} 时加在扩展名前
+		{"results/monthly.xlsx", "results/monthly_20261001-020005.xlsx"},
+		{"results/monthly", "results/monthly_20261001-020005"},
+	}
+	for _, tt := range tests {
+		if got := timestampedOutput(tt.output, start); got != tt.want {
+			t.Errorf("timestampedOutput(%q) = %q，应为 %q", tt.output, got, tt.want)
+		}
+	}
+}
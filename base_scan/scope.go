@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 授权范围文件，见 scope.example.yaml
+type scopeFile struct {
+	Allow        []string `yaml:"allow"`
+	Exclude      []string `yaml:"exclude"`
+	TrustDomains bool     `yaml:"trust_domains"` // allow中的域名解析出的地址都视为授权
+}
+
+// IP、网段和域名列表
+type scopeList struct {
+	prefixes []netip.Prefix
+	entries  []string // 与prefixes对应的原始写法，用于说明原因
+	domains  []string // 小写，"*.example.com" 只匹配子域名，"example.com" 同时匹配自身和子域名
+}
+
+// 授权范围。allow为空时只检查排除列表
+type scope struct {
+	allow        scopeList
+	exclude      scopeList
+	trustDomains bool
+	resolver     *domainResolver
+}
+
+func loadScope(filename string, resolver *domainResolver) (*scope, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("读取授权范围文件失败: %v", err)
+	}
+	var doc scopeFile
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("解析授权范围文件失败: %v", err)
+	}
+
+	s := &scope{trustDomains: doc.TrustDomains, resolver: resolver}
+	if s.allow, err = parseScopeList(doc.Allow); err != nil {
+		return nil, fmt.Errorf("授权范围 allow: %v", err)
+	}
+	if s.exclude, err = parseScopeList(doc.Exclude); err != nil {
+		return nil, fmt.Errorf("授权范围 exclude: %v", err)
+	}
+	if len(s.allow.domains) > 0 && !s.trustDomains {
+		logf("警告: 授权范围 allow 中的域名只在 trust_domains: true 时生效，否则解析出的地址仍须在 allow 的IP或网段中\n")
+	}
+	return s, nil
+}
+
+func parseScopeList(entries []string) (scopeList, error) {
+	var list scopeList
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			list.prefixes = append(list.prefixes, prefix.Masked())
+			list.entries = append(list.entries, entry)
+			continue
+		}
+		if addr, err := netip.ParseAddr(entry); err == nil {
+			list.prefixes = append(list.prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			list.entries = append(list.entries, entry)
+			continue
+		}
+		domain := strings.ToLower(strings.TrimSuffix(entry, "."))
+		if strings.ContainsAny(domain, "/: ") || strings.Trim(domain, "*.") == "" {
+			return list, fmt.Errorf("%q 不是有效的IP、网段或域名", entry)
+		}
+		list.domains = append(list.domains, domain)
+	}
+	return list, nil
+}
+
+func (l scopeList) empty() bool {
+	return len(l.prefixes) == 0 && len(l.domains) == 0
+}
+
+// 返回包含该地址的条目
+func (l scopeList) matchAddr(addr netip.Addr) (string, bool) {
+	addr = addr.Unmap()
+	for i, prefix := range l.prefixes {
+		if prefix.Contains(addr) {
+			return l.entries[i], true
+		}
+	}
+	return "", false
+}
+
+// 返回匹配该域名的条目
+func (l scopeList) matchDomain(host string) (string, bool) {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "" {
+		return "", false
+	}
+	for _, domain := range l.domains {
+		if sub, ok := strings.CutPrefix(domain, "*."); ok {
+			if strings.HasSuffix(host, "."+sub) {
+				return domain, true
+			}
+		} else if host == domain || strings.HasSuffix(host, "."+domain) {
+			return domain, true
+		}
+	}
+	return "", false
+}
+
+// 检查一行是否在授权范围内，返回不在范围内的原因，在范围内时返回空。
+// 解析出的地址都要在allow的IP或网段中，trust_domains为true时域名在allow中也视为授权，
+// 但解析出的地址仍要检查排除列表。IP列中的主机名会先解析，所有地址都要检查，
+// 在范围内时同时返回检查过的地址，扫描时使用该地址，避免nmap再次解析得到其他地址
+func (s *scope) check(info ExcelInfo) (reason, addr string) {
+	if s == nil || info.IP == "" {
+		return "", ""
+	}
+
+	if addr, err := netip.ParseAddr(info.IP); err == nil {
+		var domain string
+		if info.IPSource != "" {
+			domain = domainHost(info.Domain)
+		}
+		return s.checkAddrs(domain, []netip.Addr{addr}), ""
+	}
+
+	host := strings.ToLower(strings.TrimSuffix(info.IP, "."))
+	if entry, ok := s.exclude.matchDomain(host); ok {
+		return fmt.Sprintf("%s 在排除列表中(%s)", host, entry), ""
+	}
+	resolved, err := s.resolver.lookup(host)
+	if err != nil || len(resolved) == 0 {
+		return fmt.Sprintf("无法解析 %s，不能确认是否在授权范围内", host), ""
+	}
+	var addrs []netip.Addr
+	for _, r := range resolved {
+		if addr, err := netip.ParseAddr(r); err == nil {
+			addrs = append(addrs, addr)
+		}
+	}
+	if reason := s.checkAddrs(host, addrs); reason != "" {
+		return reason, ""
+	}
+	// 与nmap一样只扫描第一个地址，lookup返回时IPv4在前
+	return "", addrs[0].String()
+}
+
+// domain为地址来源的域名，可以为空
+func (s *scope) checkAddrs(domain string, addrs []netip.Addr) string {
+	for _, addr := range addrs {
+		if entry, ok := s.exclude.matchAddr(addr); ok {
+			return fmt.Sprintf("%s 在排除列表中(%s)", addr, entry)
+		}
+	}
+	if entry, ok := s.exclude.matchDomain(domain); ok {
+		return fmt.Sprintf("%s 在排除列表中(%s)", domain, entry)
+	}
+	if s.allow.empty() {
+		return ""
+	}
+	if _, ok := s.allow.matchDomain(domain); ok && s.trustDomains {
+		return ""
+	}
+	for _, addr := range addrs {
+		if _, ok := s.allow.matchAddr(addr); !ok {
+			if domain != "" {
+				return fmt.Sprintf("%s (%s) 不在授权范围内", addr, domain)
+			}
+			return fmt.Sprintf("%s 不在授权范围内", addr)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// 授权范围检查使用的DNS记录，不在其中的域名无法解析
+var scopeRecords = map[string][]string{
+	"app.example.test": {"127.0.0.1"},
+	"mail.example.com": {"10.0.0.25"},
+}
+
+func writeScope(t *testing.T, content string) *scope {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "scope.yaml")
+	if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := loadScope(file, newStubResolver(t, scopeRecords))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestScopeCheck(t *testing.T) {
+	const lists = `
+allow: [10.0.0.0/8, 127.0.0.0/8, "::1", example.com, app.example.test.]
+exclude: [10.0.0.1, mail.example.com]
+`
+	strict := writeScope(t, lists)
+	trusted := writeScope(t, lists+"trust_domains: true\n")
+	resolved := func(domain, ip string) ExcelInfo {
+		return ExcelInfo{Domain: domain, IP: ip, IPSource: "DNS解析: " + domainHost(domain)}
+	}
+
+	tests := []struct {
+		s      *scope
+		info   ExcelInfo
+		reason string // 为空表示在范围内
+	}{
+		{strict, ExcelInfo{IP: "10.1.2.3"}, ""},
+		{strict, ExcelInfo{IP: "11.0.0.1"}, "不在授权范围内"},
+		{strict, ExcelInfo{IP: "10.0.0.1"}, "排除列表"},
+		// 直接填写的IP不看网站地址
+		{trusted, ExcelInfo{Domain: "www.example.com", IP: "203.0.113.5"}, "不在授权范围内"},
+		// 解析出的地址默认也要在网段中，域名只在 trust_domains 时作为授权依据
+		{strict, resolved("https://www.example.com/login", "203.0.113.5"), "不在授权范围内"},
+		{strict, resolved("https://www.example.com/login", "10.2.3.4"), ""},
+		{trusted, resolved("https://www.example.com/login", "203.0.113.5"), ""},
+		{trusted, resolved("mail.example.com", "203.0.113.5"), "排除列表"},
+		{trusted, resolved("www.example.com", "10.0.0.1"), "排除列表"},
+		{strict, ExcelInfo{IP: "mail.example.com"}, "排除列表"},
+		{strict, ExcelInfo{IP: "nothing.example.test"}, "无法解析"},
+	}
+	for _, tt := range tests {
+		reason, addr := tt.s.check(tt.info)
+		if (tt.reason == "") != (reason == "") || !strings.Contains(reason, tt.reason) {
+			t.Errorf("trust_domains=%v check(%+v) = %q，应包含 %q", tt.s.trustDomains, tt.info, reason, tt.reason)
+		}
+		if addr != "" {
+			t.Errorf("check(%+v) 不是主机名目标，不应返回地址 %q", tt.info, addr)
+		}
+	}
+
+	// 主机名目标返回检查过的地址，扫描时不再解析
+	for _, s := range []*scope{strict, trusted} {
+		if reason, addr := s.check(ExcelInfo{IP: "app.example.test"}); reason != "" || addr != "127.0.0.1" {
+			t.Errorf("trust_domains=%v check(app.example.test) = %q, %q，应为 127.0.0.1", s.trustDomains, reason, addr)
+		}
+	}
+	strict = writeScope(t, "allow: [10.0.0.0/8, app.example.test]\n")
+	if reason, addr := strict.check(ExcelInfo{IP: "app.example.test"}); !strings.Contains(reason, "不在授权范围内") || addr != "" {
+		t.Errorf("地址不在网段中时 check(app.example.test) = %q, %q", reason, addr)
+	}
+	trusted = writeScope(t, "allow: [10.0.0.0/8, app.example.test]\ntrust_domains: true\n")
+	if reason, addr := trusted.check(ExcelInfo{IP: "app.example.test"}); reason != "" || addr != "127.0.0.1" {
+		t.Errorf("trust_domains 时 check(app.example.test) = %q, %q，应为 127.0.0.1", reason, addr)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	nmapscan "github.com/helar52-xl/batch_scan_ip_base_nmap/nmap_scan"
+)
+
+// NSE脚本的输出
+type ScriptOutput struct {
+	ID     string `json:"id"`
+	Output string `json:"output"`
+}
+
+// Excel单元格最多32767个字符
+const maxCellText = 32000
+
+func scriptOutputs(scripts []nmapscan.Script) []ScriptOutput {
+	var outputs []ScriptOutput
+	for _, s := range scripts {
+		outputs = append(outputs, ScriptOutput{ID: s.ID, Output: strings.TrimSpace(s.Output)})
+	}
+	return outputs
+}
+
+// 从脚本结果中取出单独成列的 http-title 和 ssl-cert
+func promoteScripts(port *PortInfo, scripts []nmapscan.Script) {
+	for i := range scripts {
+		s := &scripts[i]
+		switch s.ID {
+		case "http-title":
+			port.HTTPTitle = s.Lookup("title")
+			if port.HTTPTitle == "" {
+				port.HTTPTitle = strings.TrimSpace(s.Output)
+			}
+		case "ssl-cert":
+			port.SSLCert = sslCertSummary(s)
+		}
+	}
+}
+
+// 证书摘要，如 "CN=www.example.com; 颁发者: R3; 到期: 2025-01-01"
+func sslCertSummary(s *nmapscan.Script) string {
+	var parts []string
+	if cn := s.Lookup("subject", "commonName"); cn != "" {
+		parts = append(parts, "CN="+cn)
+	}
+	if issuer := s.Lookup("issuer", "commonName"); issuer != "" {
+		parts = append(parts, "颁发者: "+issuer)
+	}
+	if notAfter := s.Lookup("validity", "notAfter"); notAfter != "" {
+		if len(notAfter) > 10 {
+			notAfter = notAfter[:10]
+		}
+		parts = append(parts, "到期: "+notAfter)
+	}
+	if len(parts) == 0 {
+		// 没有结构化输出时取文本输出的第一行
+		line, _, _ := strings.Cut(strings.TrimSpace(s.Output), "\n")
+		return line
+	}
+	return strings.Join(parts, "; ")
+}
+
+func truncateCell(s string) string {
+	runes := []rune(s)
+	if len(runes) <= maxCellText {
+		return s
+	}
+	return string(runes[:maxCellText]) + fmt.Sprintf("\n...(共%d个字符)", len(runes))
+}
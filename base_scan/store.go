@@ -0,0 +1,649 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// 一次运行的信息
+type runInfo struct {
+	ID         int64
+	Source     string
+	NmapArgs   string
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Hosts      int
+}
+
+// 历史查询条件，为空的条件不参与过滤
+type historyQuery struct {
+	IP      string
+	Port    string
+	Service string
+	Org     string
+}
+
+// 历史查询结果，同一IP的同一端口按运行汇总
+type historyRow struct {
+	IP        string
+	Number    string
+	Port      string
+	Protocol  string
+	State     string
+	Service   string
+	Version   string
+	FirstSeen time.Time
+	LastSeen  time.Time
+	Runs      int
+}
+
+// 扫描历史存储，扫描时写入，导出和 history 子命令从中读取
+type resultStore interface {
+	BeginRun(source string, nmapArgs string) (int64, error)
+	SaveHost(runID int64, rec hostRecord) error
+	FinishRun(runID int64) error
+	Runs() ([]runInfo, error)
+	Hosts(runID int64) ([]hostRecord, error)
+	Query(q historyQuery) ([]historyRow, error)
+	Close() error
+}
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS runs (
+	id          INTEGER PRIMARY KEY AUTOINCREMENT,
+	source      TEXT NOT NULL,
+	nmap_args   TEXT NOT NULL,
+	started_at  TEXT NOT NULL,
+	finished_at TEXT NOT NULL DEFAULT ''
+);
+CREATE TABLE IF NOT EXISTS hosts (
+	id           INTEGER PRIMARY KEY AUTOINCREMENT,
+	run_id       INTEGER NOT NULL REFERENCES runs(id),
+	row          INTEGER NOT NULL,
+	number       TEXT NOT NULL,
+	name         TEXT NOT NULL,
+	domain       TEXT NOT NULL,
+	ip           TEXT NOT NULL,
+	source_port  TEXT NOT NULL,
+	remark       TEXT NOT NULL,
+	ip_source    TEXT NOT NULL,
+	status       TEXT NOT NULL,
+	error        TEXT NOT NULL,
+	os           TEXT NOT NULL,
+	os_guesses   TEXT NOT NULL,
+	scan_start   TEXT NOT NULL,
+	duration_sec REAL NOT NULL,
+	nmap_version TEXT NOT NULL,
+	nmap_args    TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_hosts_ip ON hosts(ip);
+CREATE TABLE IF NOT EXISTS ports (
+	id              INTEGER PRIMARY KEY AUTOINCREMENT,
+	host_id         INTEGER NOT NULL REFERENCES hosts(id),
+	port            TEXT NOT NULL,
+	protocol        TEXT NOT NULL,
+	state           TEXT NOT NULL,
+	service         TEXT NOT NULL,
+	version         TEXT NOT NULL,
+	product         TEXT NOT NULL,
+	product_version TEXT NOT NULL,
+	extra_info      TEXT NOT NULL,
+	cpe             TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_ports_host ON ports(host_id);
+CREATE INDEX IF NOT EXISTS idx_ports_port ON ports(port);
+CREATE TABLE IF NOT EXISTS os_matches (
+	id       INTEGER PRIMARY KEY AUTOINCREMENT,
+	host_id  INTEGER NOT NULL REFERENCES hosts(id),
+	name     TEXT NOT NULL,
+	accuracy INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS scripts (
+	id        INTEGER PRIMARY KEY AUTOINCREMENT,
+	host_id   INTEGER NOT NULL REFERENCES hosts(id),
+	port_id   INTEGER NOT NULL DEFAULT 0,
+	script_id TEXT NOT NULL,
+	output    TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_scripts_host ON scripts(host_id);
+CREATE TABLE IF NOT EXISTS findings (
+	id       INTEGER PRIMARY KEY AUTOINCREMENT,
+	port_id  INTEGER NOT NULL REFERENCES ports(id),
+	rule     TEXT NOT NULL,
+	severity TEXT NOT NULL,
+	finding  TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_findings_port ON findings(port_id);
+CREATE TABLE IF NOT EXISTS traceroute (
+	id      INTEGER PRIMARY KEY AUTOINCREMENT,
+	host_id INTEGER NOT NULL REFERENCES hosts(id),
+	ttl     INTEGER NOT NULL,
+	ip      TEXT NOT NULL,
+	host    TEXT NOT NULL,
+	rtt_ms  REAL NOT NULL
+);
+CREATE TABLE IF NOT EXISTS extra_ports (
+	id      INTEGER PRIMARY KEY AUTOINCREMENT,
+	host_id INTEGER NOT NULL REFERENCES hosts(id),
+	state   TEXT NOT NULL,
+	count   INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS phases (
+	id           INTEGER PRIMARY KEY AUTOINCREMENT,
+	host_id      INTEGER NOT NULL REFERENCES hosts(id),
+	name         TEXT NOT NULL,
+	args         TEXT NOT NULL,
+	duration_sec REAL NOT NULL,
+	open_ports   INTEGER NOT NULL
+);
+`
+
+// 后来增加的列，建表后逐个检查，旧数据库通过 ALTER TABLE 补上
+var sqliteColumns = []struct{ table, column, def string }{
+	{"hosts", "host_state", "TEXT NOT NULL DEFAULT ''"},
+	{"hosts", "host_reason", "TEXT NOT NULL DEFAULT ''"},
+	{"hosts", "latency_ms", "REAL NOT NULL DEFAULT 0"},
+	{"hosts", "mac", "TEXT NOT NULL DEFAULT ''"},
+	{"hosts", "mac_vendor", "TEXT NOT NULL DEFAULT ''"},
+	{"hosts", "rdns", "TEXT NOT NULL DEFAULT ''"},
+	{"hosts", "uptime_sec", "INTEGER NOT NULL DEFAULT 0"},
+	{"hosts", "last_boot", "TEXT NOT NULL DEFAULT ''"},
+	{"hosts", "distance", "INTEGER NOT NULL DEFAULT 0"},
+	{"ports", "cves", "TEXT NOT NULL DEFAULT ''"},
+	{"ports", "cvss", "REAL NOT NULL DEFAULT 0"},
+	{"ports", "http_title", "TEXT NOT NULL DEFAULT ''"},
+	{"ports", "ssl_cert", "TEXT NOT NULL DEFAULT ''"},
+}
+
+// 基于SQLite(纯Go驱动)的历史存储
+type sqliteStore struct {
+	db *sql.DB
+}
+
+func openSQLiteStore(filename string) (*sqliteStore, error) {
+	db, err := sql.Open("sqlite", filename)
+	if err != nil {
+		return nil, fmt.Errorf("打开数据库失败: %v", err)
+	}
+	// SQLite同一时间只允许一个写入者，多个定时任务同时写入时等待锁释放
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec("PRAGMA busy_timeout = 10000"); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("初始化数据库失败: %v", err)
+	}
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("初始化数据库失败: %v", err)
+	}
+	if err := addMissingColumns(db, sqliteColumns); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("初始化数据库失败: %v", err)
+	}
+	return &sqliteStore{db: db}, nil
+}
+
+func addMissingColumns(db *sql.DB, columns []struct{ table, column, def string }) error {
+	for _, c := range columns {
+		var n int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, c.table, c.column).Scan(&n); err != nil {
+			return err
+		}
+		if n > 0 {
+			continue
+		}
+		if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", c.table, c.column, c.def)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func parseTime(s string) time.Time {
+	t, _ := time.Parse(time.RFC3339, s)
+	return t
+}
+
+func (s *sqliteStore) BeginRun(source string, nmapArgs string) (int64, error) {
+	res, err := s.db.Exec(`INSERT INTO runs (source, nmap_args, started_at) VALUES (?, ?, ?)`,
+		source, nmapArgs, formatTime(time.Now()))
+	if err != nil {
+		return 0, fmt.Errorf("写入运行记录失败: %v", err)
+	}
+	return res.LastInsertId()
+}
+
+func (s *sqliteStore) FinishRun(runID int64) error {
+	if _, err := s.db.Exec(`UPDATE runs SET finished_at = ? WHERE id = ?`, formatTime(time.Now()), runID); err != nil {
+		return fmt.Errorf("更新运行记录失败: %v", err)
+	}
+	return nil
+}
+
+func (s *sqliteStore) SaveHost(runID int64, rec hostRecord) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("写入数据库失败: %v", err)
+	}
+	defer tx.Rollback()
+
+	scanStart := ""
+	if rec.ScanStart != nil {
+		scanStart = formatTime(*rec.ScanStart)
+	}
+	res, err := tx.Exec(`INSERT INTO hosts (run_id, row, number, name, domain, ip, source_port, remark, ip_source,
+		status, error, os, os_guesses, scan_start, duration_sec, nmap_version, nmap_args,
+		host_state, host_reason, latency_ms, mac, mac_vendor, rdns, uptime_sec, last_boot, distance)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		runID, rec.Row, rec.Number, rec.Name, rec.Domain, rec.IP, rec.SourcePort, rec.Remark, rec.IPSource,
+		rec.Status, rec.Error, strings.Join(rec.OS, "\n"), strings.Join(rec.OSGuesses, "\n"),
+		scanStart, rec.DurationSec, rec.NmapVersion, rec.NmapArgs,
+		rec.HostState, rec.HostReason, rec.LatencyMS, rec.MAC, rec.MACVendor, rec.RDNS, rec.UptimeSec,
+		rec.LastBoot, rec.Distance)
+	if err != nil {
+		return fmt.Errorf("写入主机记录失败: %v", err)
+	}
+	hostID, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("写入主机记录失败: %v", err)
+	}
+
+	for _, p := range rec.Ports {
+		res, err := tx.Exec(`INSERT INTO ports (host_id, port, protocol, state, service, version, product,
+			product_version, extra_info, cpe, cves, cvss, http_title, ssl_cert)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			hostID, p.Port, p.Protocol, p.State, p.Service, p.Version, p.Product,
+			p.ProductVersion, p.ExtraInfo, strings.Join(p.CPE, " "), strings.Join(p.CVEs, " "), p.CVSS,
+			p.HTTPTitle, p.SSLCert)
+		if err != nil {
+			return fmt.Errorf("写入端口记录失败: %v", err)
+		}
+		portID, err := res.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("写入端口记录失败: %v", err)
+		}
+		if err := saveScripts(tx, hostID, portID, p.Scripts); err != nil {
+			return err
+		}
+		for _, f := range p.Findings {
+			if _, err := tx.Exec(`INSERT INTO findings (port_id, rule, severity, finding) VALUES (?, ?, ?, ?)`,
+				portID, f.Rule, f.Severity, f.Finding); err != nil {
+				return fmt.Errorf("写入风险记录失败: %v", err)
+			}
+		}
+	}
+	if err := saveScripts(tx, hostID, 0, rec.HostScripts); err != nil {
+		return err
+	}
+	for _, m := range rec.OSMatches {
+		if _, err := tx.Exec(`INSERT INTO os_matches (host_id, name, accuracy) VALUES (?, ?, ?)`,
+			hostID, m.Name, m.Accuracy); err != nil {
+			return fmt.Errorf("写入操作系统记录失败: %v", err)
+		}
+	}
+	for _, h := range rec.Traceroute {
+		if _, err := tx.Exec(`INSERT INTO traceroute (host_id, ttl, ip, host, rtt_ms) VALUES (?, ?, ?, ?, ?)`,
+			hostID, h.TTL, h.IP, h.Host, h.RTTMS); err != nil {
+			return fmt.Errorf("写入路由记录失败: %v", err)
+		}
+	}
+	for _, e := range rec.ExtraPorts {
+		if _, err := tx.Exec(`INSERT INTO extra_ports (host_id, state, count) VALUES (?, ?, ?)`,
+			hostID, e.State, e.Count); err != nil {
+			return fmt.Errorf("写入端口汇总记录失败: %v", err)
+		}
+	}
+	for _, p := range rec.Phases {
+		if _, err := tx.Exec(`INSERT INTO phases (host_id, name, args, duration_sec, open_ports) VALUES (?, ?, ?, ?, ?)`,
+			hostID, p.Name, p.Args, p.DurationSec, p.OpenPorts); err != nil {
+			return fmt.Errorf("写入扫描阶段记录失败: %v", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// 脚本输出，portID为0时是主机脚本
+func saveScripts(tx *sql.Tx, hostID, portID int64, scripts []ScriptOutput) error {
+	for _, sc := range scripts {
+		if _, err := tx.Exec(`INSERT INTO scripts (host_id, port_id, script_id, output) VALUES (?, ?, ?, ?)`,
+			hostID, portID, sc.ID, sc.Output); err != nil {
+			return fmt.Errorf("写入脚本记录失败: %v", err)
+		}
+	}
+	return nil
+}
+
+func (s *sqliteStore) Runs() ([]runInfo, error) {
+	rows, err := s.db.Query(`SELECT r.id, r.source, r.nmap_args, r.started_at, r.finished_at,
+		(SELECT COUNT(*) FROM hosts h WHERE h.run_id = r.id)
+		FROM runs r ORDER BY r.id`)
+	if err != nil {
+		return nil, fmt.Errorf("查询运行记录失败: %v", err)
+	}
+	defer rows.Close()
+
+	var runs []runInfo
+	for rows.Next() {
+		var run runInfo
+		var started, finished string
+		if err := rows.Scan(&run.ID, &run.Source, &run.NmapArgs, &started, &finished, &run.Hosts); err != nil {
+			return nil, fmt.Errorf("查询运行记录失败: %v", err)
+		}
+		run.StartedAt = parseTime(started)
+		run.FinishedAt = parseTime(finished)
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+// 读取某次运行的全部主机记录，按源文件顺序
+func (s *sqliteStore) Hosts(runID int64) ([]hostRecord, error) {
+	rows, err := s.db.Query(`SELECT id, row, number, name, domain, ip, source_port, remark, ip_source,
+		status, error, os, os_guesses, scan_start, duration_sec, nmap_version, nmap_args,
+		host_state, host_reason, latency_ms, mac, mac_vendor, rdns, uptime_sec, last_boot, distance
+		FROM hosts WHERE run_id = ? ORDER BY row, id`, runID)
+	if err != nil {
+		return nil, fmt.Errorf("查询主机记录失败: %v", err)
+	}
+	defer rows.Close()
+
+	var ids []int64
+	var hosts []hostRecord
+	for rows.Next() {
+		var id int64
+		var osInfo, osGuesses, scanStart string
+		rec := hostRecord{SchemaVersion: schemaVersion}
+		if err := rows.Scan(&id, &rec.Row, &rec.Number, &rec.Name, &rec.Domain, &rec.IP, &rec.SourcePort,
+			&rec.Remark, &rec.IPSource, &rec.Status, &rec.Error, &osInfo, &osGuesses, &scanStart,
+			&rec.DurationSec, &rec.NmapVersion, &rec.NmapArgs, &rec.HostState, &rec.HostReason,
+			&rec.LatencyMS, &rec.MAC, &rec.MACVendor, &rec.RDNS, &rec.UptimeSec, &rec.LastBoot,
+			&rec.Distance); err != nil {
+			return nil, fmt.Errorf("查询主机记录失败: %v", err)
+		}
+		rec.OS = splitLines(osInfo)
+		rec.OSGuesses = splitLines(osGuesses)
+		if t := parseTime(scanStart); !t.IsZero() {
+			rec.ScanStart = &t
+		}
+		ids = append(ids, id)
+		hosts = append(hosts, rec)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i, id := range ids {
+		rec := &hosts[i]
+		if rec.Ports, err = s.hostPorts(id); err != nil {
+			return nil, err
+		}
+		if rec.OSMatches, err = s.hostOSMatches(id); err != nil {
+			return nil, err
+		}
+		if rec.HostScripts, err = s.scripts(id, 0); err != nil {
+			return nil, err
+		}
+		if rec.Traceroute, err = s.hostTraceroute(id); err != nil {
+			return nil, err
+		}
+		if rec.ExtraPorts, err = s.hostExtraPorts(id); err != nil {
+			return nil, err
+		}
+		if rec.Phases, err = s.hostPhases(id); err != nil {
+			return nil, err
+		}
+	}
+	return hosts, nil
+}
+
+func (s *sqliteStore) hostPorts(hostID int64) ([]portRecord, error) {
+	rows, err := s.db.Query(`SELECT id, port, protocol, state, service, version, product, product_version,
+		extra_info, cpe, cves, cvss, http_title, ssl_cert FROM ports WHERE host_id = ? ORDER BY id`, hostID)
+	if err != nil {
+		return nil, fmt.Errorf("查询端口记录失败: %v", err)
+	}
+	defer rows.Close()
+
+	var ids []int64
+	ports := make([]portRecord, 0)
+	for rows.Next() {
+		var id int64
+		var p portRecord
+		var cpe, cves string
+		if err := rows.Scan(&id, &p.Port, &p.Protocol, &p.State, &p.Service, &p.Version, &p.Product,
+			&p.ProductVersion, &p.ExtraInfo, &cpe, &cves, &p.CVSS, &p.HTTPTitle, &p.SSLCert); err != nil {
+			return nil, fmt.Errorf("查询端口记录失败: %v", err)
+		}
+		p.CPE = fieldsOrNil(cpe)
+		p.CVEs = fieldsOrNil(cves)
+		ids = append(ids, id)
+		ports = append(ports, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for i, id := range ids {
+		if ports[i].Scripts, err = s.scripts(hostID, id); err != nil {
+			return nil, err
+		}
+		if ports[i].Findings, err = s.portFindings(id); err != nil {
+			return nil, err
+		}
+	}
+	return ports, nil
+}
+
+func (s *sqliteStore) scripts(hostID, portID int64) ([]ScriptOutput, error) {
+	rows, err := s.db.Query(`SELECT script_id, output FROM scripts WHERE host_id = ? AND port_id = ? ORDER BY id`,
+		hostID, portID)
+	if err != nil {
+		return nil, fmt.Errorf("查询脚本记录失败: %v", err)
+	}
+	defer rows.Close()
+
+	var scripts []ScriptOutput
+	for rows.Next() {
+		var sc ScriptOutput
+		if err := rows.Scan(&sc.ID, &sc.Output); err != nil {
+			return nil, fmt.Errorf("查询脚本记录失败: %v", err)
+		}
+		scripts = append(scripts, sc)
+	}
+	return scripts, rows.Err()
+}
+
+func (s *sqliteStore) portFindings(portID int64) ([]finding, error) {
+	rows, err := s.db.Query(`SELECT rule, severity, finding FROM findings WHERE port_id = ? ORDER BY id`, portID)
+	if err != nil {
+		return nil, fmt.Errorf("查询风险记录失败: %v", err)
+	}
+	defer rows.Close()
+
+	var findings []finding
+	for rows.Next() {
+		var f finding
+		if err := rows.Scan(&f.Rule, &f.Severity, &f.Finding); err != nil {
+			return nil, fmt.Errorf("查询风险记录失败: %v", err)
+		}
+		findings = append(findings, f)
+	}
+	return findings, rows.Err()
+}
+
+func (s *sqliteStore) hostTraceroute(hostID int64) ([]hopRecord, error) {
+	rows, err := s.db.Query(`SELECT ttl, ip, host, rtt_ms FROM traceroute WHERE host_id = ? ORDER BY id`, hostID)
+	if err != nil {
+		return nil, fmt.Errorf("查询路由记录失败: %v", err)
+	}
+	defer rows.Close()
+
+	var hops []hopRecord
+	for rows.Next() {
+		var h hopRecord
+		if err := rows.Scan(&h.TTL, &h.IP, &h.Host, &h.RTTMS); err != nil {
+			return nil, fmt.Errorf("查询路由记录失败: %v", err)
+		}
+		hops = append(hops, h)
+	}
+	return hops, rows.Err()
+}
+
+func (s *sqliteStore) hostExtraPorts(hostID int64) ([]extraPorts, error) {
+	rows, err := s.db.Query(`SELECT state, count FROM extra_ports WHERE host_id = ? ORDER BY id`, hostID)
+	if err != nil {
+		return nil, fmt.Errorf("查询端口汇总记录失败: %v", err)
+	}
+	defer rows.Close()
+
+	var extra []extraPorts
+	for rows.Next() {
+		var e extraPorts
+		if err := rows.Scan(&e.State, &e.Count); err != nil {
+			return nil, fmt.Errorf("查询端口汇总记录失败: %v", err)
+		}
+		extra = append(extra, e)
+	}
+	return extra, rows.Err()
+}
+
+func (s *sqliteStore) hostPhases(hostID int64) ([]phaseRecord, error) {
+	rows, err := s.db.Query(`SELECT name, args, duration_sec, open_ports FROM phases WHERE host_id = ? ORDER BY id`, hostID)
+	if err != nil {
+		return nil, fmt.Errorf("查询扫描阶段记录失败: %v", err)
+	}
+	defer rows.Close()
+
+	var phases []phaseRecord
+	for rows.Next() {
+		var p phaseRecord
+		if err := rows.Scan(&p.Name, &p.Args, &p.DurationSec, &p.OpenPorts); err != nil {
+			return nil, fmt.Errorf("查询扫描阶段记录失败: %v", err)
+		}
+		phases = append(phases, p)
+	}
+	return phases, rows.Err()
+}
+
+func (s *sqliteStore) hostOSMatches(hostID int64) ([]osMatchRecord, error) {
+	rows, err := s.db.Query(`SELECT name, accuracy FROM os_matches WHERE host_id = ? ORDER BY id`, hostID)
+	if err != nil {
+		return nil, fmt.Errorf("查询操作系统记录失败: %v", err)
+	}
+	defer rows.Close()
+
+	matches := make([]osMatchRecord, 0)
+	for rows.Next() {
+		var m osMatchRecord
+		if err := rows.Scan(&m.Name, &m.Accuracy); err != nil {
+			return nil, fmt.Errorf("查询操作系统记录失败: %v", err)
+		}
+		matches = append(matches, m)
+	}
+	return matches, rows.Err()
+}
+
+// 按IP、端口、服务、所属单位查询端口的首次和最后出现时间
+func (s *sqliteStore) Query(q historyQuery) ([]historyRow, error) {
+	query := `SELECT h.ip, MAX(h.number), p.port, p.protocol, p.state, MAX(p.service), MAX(p.version),
+		MIN(r.started_at), MAX(r.started_at), COUNT(DISTINCT r.id)
+		FROM ports p JOIN hosts h ON p.host_id = h.id JOIN runs r ON h.run_id = r.id`
+	var conds []string
+	var args []interface{}
+	if q.IP != "" {
+		conds = append(conds, "h.ip = ?")
+		args = append(args, q.IP)
+	}
+	if q.Port != "" {
+		conds = append(conds, "p.port = ?")
+		args = append(args, q.Port)
+	}
+	if q.Service != "" {
+		conds = append(conds, "(p.service LIKE ? OR p.version LIKE ?)")
+		args = append(args, "%"+q.Service+"%", "%"+q.Service+"%")
+	}
+	if q.Org != "" {
+		conds = append(conds, "h.number LIKE ?")
+		args = append(args, "%"+q.Org+"%")
+	}
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	query += " GROUP BY h.ip, p.port, p.protocol, p.state ORDER BY h.ip, CAST(p.port AS INTEGER), p.protocol"
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("查询历史记录失败: %v", err)
+	}
+	defer rows.Close()
+
+	var result []historyRow
+	for rows.Next() {
+		var r historyRow
+		var first, last string
+		if err := rows.Scan(&r.IP, &r.Number, &r.Port, &r.Protocol, &r.State, &r.Service, &r.Version,
+			&first, &last, &r.Runs); err != nil {
+			return nil, fmt.Errorf("查询历史记录失败: %v", err)
+		}
+		r.FirstSeen = parseTime(first)
+		r.LastSeen = parseTime(last)
+		result = append(result, r)
+	}
+	return result, rows.Err()
+}
+
+func (s *sqliteStore) Close() error {
+	return s.db.Close()
+}
+
+// 与导出时一样，没有值时为nil
+func fieldsOrNil(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Fields(s)
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return []string{}
+	}
+	return strings.Split(s, "\n")
+}
+
+// 将扫描结果写入历史存储，作为 -o 之外的另一种输出
+type storeWriter struct {
+	store resultStore
+	runID int64
+}
+
+func newStoreWriter(store resultStore, source string, nmapArgs string) (*storeWriter, error) {
+	runID, err := store.BeginRun(source, nmapArgs)
+	if err != nil {
+		return nil, err
+	}
+	return &storeWriter{store: store, runID: runID}, nil
+}
+
+func (w *storeWriter) Write(rec hostRecord) error {
+	return w.store.SaveHost(w.runID, rec)
+}
+
+func (w *storeWriter) Close() error {
+	if err := w.store.FinishRun(w.runID); err != nil {
+		w.store.Close()
+		return err
+	}
+	return w.store.Close()
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSQLiteStoreRoundTrip(t *testing.T) {
+	store, err := openSQLiteStore(filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	start := time.Date(2026, 10, 1, 8, 30, 0, 0, time.UTC)
+	want := hostRecord{
+		SchemaVersion: schemaVersion,
+		Row:           3,
+		Number:        "单位A",
+		Name:          "门户网站",
+		Domain:        "www.example.com",
+		IP:            "10.0.0.5",
+		SourcePort:    "443",
+		Remark:        "备注",
+		IPSource:      "resolved",
+		Status:        statusScanned,
+		OS:            []string{"Linux 5.X"},
+		OSGuesses:     []string{"Linux 5.0 - 5.14 (96%)", "Linux 4.15 (90%)"},
+		OSMatches:     []osMatchRecord{{Name: "Linux 5.0 - 5.14", Accuracy: 96}},
+		Ports: []portRecord{
+			{
+				Port: "443", Protocol: "tcp", State: "open", Service: "https", Version: "nginx 1.18.0",
+				Product: "nginx", ProductVersion: "1.18.0", ExtraInfo: "Ubuntu",
+				CPE:      []string{"cpe:/a:igor_sysoev:nginx:1.18.0", "cpe:/o:linux:linux_kernel"},
+				Findings: []finding{{Rule: "old-nginx", Severity: "high", Finding: "nginx 版本过旧"}},
+				CVEs:     []string{"CVE-2021-23017"}, CVSS: 7.7,
+				HTTPTitle: "Welcome", SSLCert: "CN=www.example.com",
+				Scripts: []ScriptOutput{{ID: "http-title", Output: "Welcome"}, {ID: "ssl-cert", Output: "Subject: CN=www.example.com"}},
+			},
+			{Port: "22", Protocol: "tcp", State: "closed", Service: "ssh"},
+		},
+		ScanStart:   &start,
+		DurationSec: 12.5,
+		NmapVersion: "7.94",
+		NmapArgs:    "nmap -sV -O 10.0.0.5",
+		HostScripts: []ScriptOutput{{ID: "smb-os-discovery", Output: "OS: Windows"}},
+		HostState:   "up",
+		HostReason:  "syn-ack",
+		LatencyMS:   1.25,
+		MAC:         "00:11:22:33:44:55",
+		MACVendor:   "Acme",
+		RDNS:        "host5.example.com",
+		UptimeSec:   86400,
+		LastBoot:    "Wed Sep 30 08:30:00 2026",
+		Distance:    2,
+		Traceroute:  []hopRecord{{TTL: 1, IP: "10.0.0.1", RTTMS: 0.5}, {TTL: 2, IP: "10.0.0.5", Host: "host5.example.com", RTTMS: 1.25}},
+		ExtraPorts:  []extraPorts{{State: "filtered", Count: 998}},
+		Phases:      []phaseRecord{{Name: "discover", Args: "-p- -T4", DurationSec: 8, OpenPorts: 1}, {Name: "detect", Args: "-sV -p 443", DurationSec: 4.5, OpenPorts: 1}},
+	}
+	down := hostRecord{
+		SchemaVersion: schemaVersion,
+		Row:           4,
+		IP:            "10.0.0.9",
+		Status:        statusScanned,
+		OS:            []string{},
+		OSGuesses:     []string{},
+		OSMatches:     []osMatchRecord{},
+		Ports:         []portRecord{},
+		HostState:     "down",
+		HostReason:    "no-response",
+	}
+
+	runID, err := store.BeginRun("input.xlsx", "-sV -O")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rec := range []hostRecord{want, down} {
+		if err := store.SaveHost(runID, rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.FinishRun(runID); err != nil {
+		t.Fatal(err)
+	}
+
+	hosts, err := store.Hosts(runID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hosts) != 2 {
+		t.Fatalf("读出 %d 条主机记录，应为 2", len(hosts))
+	}
+	for i, rec := range []hostRecord{want, down} {
+		if !reflect.DeepEqual(hosts[i], rec) {
+			t.Errorf("第%d条记录不一致\n读出: %+v\n写入: %+v", i, hosts[i], rec)
+		}
+	}
+
+	// 还原的扫描结果与原记录重新生成的导出记录一致
+	info, result := hosts[0].toScanResult()
+	again := newHostRecord(want.Row, info, result, want.Status, nil, start, 12500*time.Millisecond)
+	again.NmapVersion, again.NmapArgs = want.NmapVersion, want.NmapArgs
+	if !reflect.DeepEqual(again, want) {
+		t.Errorf("toScanResult 后重新导出不一致\n得到: %+v\n应为: %+v", again, want)
+	}
+}
+
+// 旧版本创建的数据库打开时补上新增的列
+func TestSQLiteStoreUpgrade(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "old.db")
+	store, err := openSQLiteStore(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.db.Exec(`ALTER TABLE hosts DROP COLUMN distance`); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	store, err = openSQLiteStore(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	runID, err := store.BeginRun("input.xlsx", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveHost(runID, hostRecord{IP: "10.0.0.1", Distance: 3}); err != nil {
+		t.Fatal(err)
+	}
+	hosts, err := store.Hosts(runID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hosts) != 1 || hosts[0].Distance != 3 {
+		t.Errorf("升级后读出 %+v", hosts)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+
+	nmapscan "github.com/helar52-xl/batch_scan_ip_base_nmap/nmap_scan"
+)
+
+// 将IP列中的网段、范围、列表展开为单个主机，每个主机单独成行并继承源行的信息。
+// 无法解析或超过 nmapscan.MaxExpand 的目标保持原样，TargetError 为原因，不扫描。
+// 端口列已填写的行不扫描，保持原样
+func expandInfos(infos []ExcelInfo) []ExcelInfo {
+	var expanded []ExcelInfo
+	for _, info := range infos {
+		if info.IP == "" || info.PORT != "" {
+			expanded = append(expanded, info)
+			continue
+		}
+
+		hosts, err := nmapscan.ExpandTargets(info.IP)
+		if err != nil {
+			info.TargetError = err.Error()
+			expanded = append(expanded, info)
+			continue
+		}
+
+		for _, host := range hosts {
+			row := info
+			row.IP = host
+			expanded = append(expanded, row)
+		}
+	}
+	return expanded
+}
+
+// 标记与前面的行扫描同一地址的行，Duplicate 指向第一次出现的行，不重复扫描。
+// 主机名在授权范围检查时才解析为地址，因此要在检查之后调用
+func markDuplicates(infos []ExcelInfo) {
+	seen := make(map[string]int)
+	for i := range infos {
+		info := &infos[i]
+		if info.IP == "" || info.PORT != "" || info.TargetError != "" || info.OutOfScope != "" {
+			continue
+		}
+		if first, ok := seen[info.IP]; ok {
+			info.Duplicate = fmt.Sprintf("与第%d行相同", first+1)
+		} else {
+			seen[info.IP] = i
+		}
+	}
+}
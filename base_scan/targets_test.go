@@ -0,0 +1,71 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExpandInfos(t *testing.T) {
+	infos := []ExcelInfo{
+		{Number: "单位A", IP: "10.0.0.0/31"},
+		{Number: "单位B", IP: "10.0.0.1"},
+		{Number: "单位C", IP: "10.0.0.0/8"},
+		{Number: "单位D", IP: "10.0.0.5", PORT: "80"},
+		{Number: "单位E"},
+		{Number: "单位F", IP: "10.0.0.2,1"},
+	}
+	got := expandInfos(infos)
+	markDuplicates(got)
+
+	want := []struct {
+		number, ip, duplicate string
+		invalid               bool
+	}{
+		{"单位A", "10.0.0.0", "", false},
+		{"单位A", "10.0.0.1", "", false},
+		// 与其他单位的行重复时保留该行，指向第一次出现的行
+		{"单位B", "10.0.0.1", "与第2行相同", false},
+		// 超过 MaxExpand 的网段不交给nmap
+		{"单位C", "10.0.0.0/8", "", true},
+		{"单位D", "10.0.0.5", "", false},
+		{"单位E", "", "", false},
+		{"单位F", "10.0.0.2", "", false},
+		{"单位F", "10.0.0.1", "与第2行相同", false},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("展开后 %d 行，应为 %d 行: %+v", len(got), len(want), got)
+	}
+	for i, w := range want {
+		g := got[i]
+		if g.Number != w.number || g.IP != w.ip || g.Duplicate != w.duplicate || (g.TargetError != "") != w.invalid {
+			t.Errorf("第%d行 = %+v，应为 %+v", i+1, g, w)
+		}
+	}
+	if !strings.Contains(got[3].TargetError, "过大") {
+		t.Errorf("10.0.0.0/8 的原因 %q", got[3].TargetError)
+	}
+	for i, info := range got {
+		if scan := info.scannable(); scan != (i == 0 || i == 1 || i == 6) {
+			t.Errorf("第%d行 %+v scannable() = %v", i+1, info, scan)
+		}
+	}
+}
+
+// 主机名在授权范围检查时固定为地址，之后与前面相同地址的行重复
+func TestMarkDuplicatesAfterScope(t *testing.T) {
+	infos := []ExcelInfo{
+		{Number: "单位A", IP: "10.0.0.1"},
+		{Number: "单位B", IP: "10.0.0.1", IPSource: "DNS解析: app.example.test"},
+		{Number: "单位C", IP: "10.0.0.2", OutOfScope: "不在授权范围内"},
+		{Number: "单位D", IP: "10.0.0.2"},
+		{Number: "单位E", IP: "10.0.0.1", PORT: "80"},
+	}
+	markDuplicates(infos)
+
+	want := []string{"", "与第1行相同", "", "", ""}
+	for i, w := range want {
+		if infos[i].Duplicate != w {
+			t.Errorf("第%d行 Duplicate = %q，应为 %q", i+1, infos[i].Duplicate, w)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	nmapscan "github.com/helar52-xl/batch_scan_ip_base_nmap/nmap_scan"
+)
+
+// 控制台输出锁，保证并发扫描时每块输出不交错
+var consoleMu sync.Mutex
+
+func logf(format string, a ...interface{}) {
+	consoleMu.Lock()
+	defer consoleMu.Unlock()
+	fmt.Printf(format, a...)
+}
+
+// 扫描任务，index为在源Excel中的行序号，seq为本次运行中的提交顺序
+type scanJob struct {
+	index int
+	seq   int
+	info  ExcelInfo
+}
+
+// 单行的扫描结果
+type scanOutcome struct {
+	index    int
+	seq      int
+	info     ExcelInfo
+	result   ScanResult
+	start    time.Time
+	duration time.Duration
+	err      error
+	// 收到中断信号时尚未开始扫描
+	notStarted bool
+	// 续扫时来自状态文件，本次没有扫描
+	replayed bool
+}
+
+// 使用固定数量的worker并发扫描，handle按源Excel的行顺序在调用方goroutine中执行，
+// 因此写Excel等操作只由调用方一个goroutine完成。replay返回true的行不扫描，直接按顺序
+// 交给handle。batchSize大于1且scanner支持时，每batchSize行由一个nmap进程扫描。
+// ctx取消后正在运行的nmap会被中断，尚未开始的行记为notStarted
+func runScans(ctx context.Context, infos []ExcelInfo, replay func(int) (scanOutcome, bool), scanner nmapscan.Scanner, opts nmapscan.Options, concurrency int, batchSize int, handle func(scanOutcome)) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	batchScanner, ok := scanner.(nmapscan.BatchScanner)
+	if !ok || batchSize < 1 {
+		batchSize = 1
+	}
+
+	batches := make(chan []scanJob)
+	outcomes := make(chan scanOutcome, concurrency)
+
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range batches {
+				if len(batch) == 1 {
+					outcomes <- scanRow(ctx, scanner, opts, batch[0])
+					continue
+				}
+				for _, outcome := range scanBatch(ctx, batchScanner, opts, batch) {
+					outcomes <- outcome
+				}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(batches)
+		seq := 0
+		var batch []scanJob
+		for i, info := range infos {
+			if replay != nil {
+				if o, ok := replay(i); ok {
+					o.seq = seq
+					seq++
+					outcomes <- o
+					continue
+				}
+			}
+			batch = append(batch, scanJob{index: i, seq: seq, info: info})
+			seq++
+			// ctx取消后worker不再扫描，很快返回，所有行都会交给handle
+			if len(batch) == batchSize {
+				batches <- batch
+				batch = nil
+			}
+		}
+		if len(batch) > 0 {
+			batches <- batch
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(outcomes)
+	}()
+
+	// 先完成的结果暂存，等前面的行都处理完再按顺序交给handle
+	pending := make(map[int]scanOutcome)
+	next := 0
+	for outcome := range outcomes {
+		pending[outcome.seq] = outcome
+		for {
+			o, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			handle(o)
+			next++
+		}
+	}
+}
+
+// 一个nmap进程扫描一批行，不需要扫描的行直接返回空结果，相同的IP只扫描一次
+func scanBatch(ctx context.Context, scanner nmapscan.BatchScanner, opts nmapscan.Options, batch []scanJob) []scanOutcome {
+	outcomes := make([]scanOutcome, len(batch))
+	targets := make(map[string]int)
+	var ips []string
+	for i, job := range batch {
+		outcomes[i] = scanOutcome{index: job.index, seq: job.seq, info: job.info}
+		if ctx.Err() != nil {
+			outcomes[i].err = ctx.Err()
+			outcomes[i].notStarted = true
+			continue
+		}
+		if ip := job.info.IP; job.info.scannable() {
+			if _, ok := targets[ip]; !ok {
+				targets[ip] = len(ips)
+				ips = append(ips, ip)
+			}
+		}
+	}
+	if len(ips) == 0 {
+		return outcomes
+	}
+
+	logf("正在扫描 %s...\n", strings.Join(ips, ", "))
+	scans := scanIPs(ctx, scanner, ips, opts)
+	for i := range outcomes {
+		if outcomes[i].notStarted || !outcomes[i].info.scannable() {
+			continue
+		}
+		scan := scans[targets[outcomes[i].info.IP]]
+		outcomes[i].result, outcomes[i].start, outcomes[i].duration, outcomes[i].err = scan.result, scan.start, scan.duration, scan.err
+		// 相同IP的行各自匹配风险规则，端口不能共用
+		outcomes[i].result.Ports = append([]PortInfo(nil), scan.result.Ports...)
+	}
+	return outcomes
+}
+
+// 扫描单行，不需要扫描的行直接返回空结果
+func scanRow(ctx context.Context, scanner nmapscan.Scanner, opts nmapscan.Options, job scanJob) scanOutcome {
+	outcome := scanOutcome{index: job.index, seq: job.seq, info: job.info}
+	if ctx.Err() != nil {
+		outcome.err = ctx.Err()
+		outcome.notStarted = true
+		return outcome
+	}
+	if !job.info.scannable() {
+		return outcome
+	}
+
+	logf("正在扫描 %s...\n", job.info.IP)
+	outcome.start = time.Now()
+	outcome.result, outcome.duration, outcome.err = scanIP(ctx, scanner, job.info.IP, opts)
+	return outcome
+}
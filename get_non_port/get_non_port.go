@@ -3,6 +3,7 @@ package getnonport
 import (
 	"fmt"
 
+	nmapscan "github.com/helar52-xl/batch_scan_ip_base_nmap/nmap_scan"
 	"github.com/xuri/excelize/v2"
 )
 
@@ -15,53 +16,73 @@ type ExcelInfo struct {
 	REMARK string
 }
 
-func ReadExcel(filename string) ([]ExcelInfo, error) {
+// ReadExcel 按表头文字定位各列，sheet 为工作表名称或序号，为空时使用 Sheet1 或第一个工作表
+func ReadExcel(filename string, sheet string) ([]ExcelInfo, error) {
 	f, err := excelize.OpenFile(filename)
 	if err != nil {
 		return nil, fmt.Errorf("打开Excel文件失败:%v", err)
 	}
 	defer f.Close()
 
-	rows, err := f.GetRows("Sheet1")
+	sheet, err = nmapscan.SelectSheet(f.GetSheetList(), sheet)
+	if err != nil {
+		return nil, fmt.Errorf("选择工作表失败:%v", err)
+	}
+	rows, err := f.GetRows(sheet)
 
 	if err != nil {
 		return nil, fmt.Errorf("读取工作表失败:%v", err)
 	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("工作表 %s 为空", sheet)
+	}
+
+	cols, err := nmapscan.MapColumns(rows[0], nmapscan.InputColumns(nmapscan.ColIP, nmapscan.ColPort))
+	if err != nil {
+		return nil, fmt.Errorf("工作表 %s %v", sheet, err)
+	}
 
 	var infos []ExcelInfo
 
 	for i := 1; i < len(rows); i++ {
 		row := rows[i]
-		if len(row) >= 3 && (row[0] != "" || row[1] != "" || row[2] != "") {
-			info := ExcelInfo{
-				line1:  row[0],
-				line2:  row[1],
-				line3:  row[2],
-				IP:     "", //ip
-				PORT:   "", //port
-				REMARK: "", //remark
-			}
-
-			if len(row) >= 4 {
-				info.IP = row[3]
-			}
-			if len(row) >= 5 {
-				info.PORT = row[4]
-			}
-			if len(row) >= 8 {
-				info.REMARK = row[7]
-			}
+		info := ExcelInfo{
+			line1:  cols.Value(row, nmapscan.ColNumber),
+			line2:  cols.Value(row, nmapscan.ColName),
+			line3:  cols.Value(row, nmapscan.ColDomain),
+			IP:     cols.Value(row, nmapscan.ColIP),
+			PORT:   cols.Value(row, nmapscan.ColPort),
+			REMARK: cols.Value(row, nmapscan.ColRemark),
+		}
+		if info.line1 != "" || info.line2 != "" || info.line3 != "" || info.IP != "" {
 			infos = append(infos, info)
-
 		}
 	}
 	return infos, nil
 }
 
+// 将记录写入新的Excel文件，表头与输入文件的标准列相同，可以直接作为扫描的源文件
 func saveIt(infos []ExcelInfo, filename string) error {
+	f := excelize.NewFile()
+	defer f.Close()
 
+	headers := []interface{}{"所属单位", "网站名称", "网站地址", "IP", "端口", "备注"}
+	if err := f.SetSheetRow("Sheet1", "A1", &headers); err != nil {
+		return fmt.Errorf("写入表头失败:%v", err)
+	}
+	for i, info := range infos {
+		row := []interface{}{info.line1, info.line2, info.line3, info.IP, info.PORT, info.REMARK}
+		if err := f.SetSheetRow("Sheet1", fmt.Sprintf("A%d", i+2), &row); err != nil {
+			return fmt.Errorf("写入第%d行失败:%v", i+2, err)
+		}
+	}
+	if err := f.SaveAs(filename); err != nil {
+		return fmt.Errorf("保存Excel文件失败:%v", err)
+	}
+	return nil
 }
 
+// 筛选出端口列为空的记录，保存到filename
 func get_non_port(infos []ExcelInfo, filename string) error {
 	var infos_non []ExcelInfo
 
@@ -71,6 +92,5 @@ func get_non_port(infos []ExcelInfo, filename string) error {
 		}
 	}
 
-	saveIt(infos_non)
-
+	return saveIt(infos_non, filename)
 }
@@ -0,0 +1,209 @@
+package nmapscan
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+)
+
+// SplitArgs 按shell规则拆分参数: 空白分隔，支持单引号、双引号和反斜杠转义
+func SplitArgs(s string) ([]string, error) {
+	var args []string
+	var cur strings.Builder
+	inArg := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			if inArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				inArg = false
+			}
+		case c == '\'':
+			// 单引号内的内容原样保留
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end < 0 {
+				return nil, errors.New("单引号未闭合")
+			}
+			cur.WriteString(s[i+1 : i+1+end])
+			i += end + 1
+			inArg = true
+		case c == '"':
+			// 双引号内只有 \" \\ 需要转义
+			i++
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) && (s[i+1] == '"' || s[i+1] == '\\') {
+					i++
+				}
+				cur.WriteByte(s[i])
+			}
+			if i >= len(s) {
+				return nil, errors.New("双引号未闭合")
+			}
+			inArg = true
+		case c == '\\':
+			if i+1 < len(s) {
+				i++
+				cur.WriteByte(s[i])
+			}
+			inArg = true
+		default:
+			cur.WriteByte(c)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, cur.String())
+	}
+	return args, nil
+}
+
+// 需要一个值的nmap选项，取自nmap源码(nmap.cc)中 long_options 里 required_argument 的选项
+// 和短选项串 "b:D:e:g:i:M:m:o:p:S:s:T:" 中单独使用时取下一个参数的选项。
+// 值可以紧跟在选项后(-p80、--top-ports=100)，也可以是下一个参数
+var valueOptions = map[string]bool{
+	// 短选项
+	"-b": true, "-D": true, "-e": true, "-g": true, "-M": true, "-p": true, "-S": true, "-T": true,
+	// 目标和主机发现
+	"-iL": true, "-iR": true, "--exclude": true, "--excludefile": true, "--dns-servers": true,
+	// 扫描方式和端口
+	"-sI": true, "--scanflags": true, "--exclude-ports": true, "--top-ports": true, "--port-ratio": true,
+	// 服务、脚本和操作系统检测
+	"--version-intensity": true, "--script": true, "--script-args": true, "--script-args-file": true,
+	"--script-help": true, "--script-timeout": true, "--max-os-tries": true,
+	// 时间和性能
+	"--min-hostgroup": true, "--max-hostgroup": true, "--min-parallelism": true, "--max-parallelism": true,
+	"--min-rtt-timeout": true, "--max-rtt-timeout": true, "--initial-rtt-timeout": true,
+	"--max-retries": true, "--host-timeout": true, "--scan-delay": true, "--max-scan-delay": true,
+	"--min-rate": true, "--max-rate": true,
+	// 防火墙/IDS规避和伪装
+	"--mtu": true, "--source-port": true, "--data": true, "--data-string": true, "--data-length": true,
+	"--ip-options": true, "--ttl": true, "--spoof-mac": true, "--proxies": true, "--proxy": true,
+	// 输出
+	"-oN": true, "-oX": true, "-oS": true, "-oG": true, "-oA": true, "-oM": true, "-oH": true,
+	"--stylesheet": true, "--resume": true, "--stats-every": true,
+	// 其他
+	"--datadir": true, "--servicedb": true, "--versiondb": true, "--nsock-engine": true, "--route-dst": true,
+}
+
+// nmap 按 getopt_long_only 解析参数，长选项也可以只写一个"-"，如 -host-timeout 5m。
+// 返回选项名，长选项统一为"--"开头并去掉"="后的值，其他参数原样返回
+func optionName(arg string) string {
+	name, _, _ := strings.Cut(arg, "=")
+	if strings.HasPrefix(name, "--") {
+		return name
+	}
+	if len(name) <= 2 || name[0] != '-' {
+		return arg
+	}
+	// -iL、-sI 这类本身就是单"-"的长选项
+	for _, n := range []string{"-" + name, name} {
+		if valueOptions[n] || conflictOptions[n] != "" || privilegedOptions[n] != "" {
+			return n
+		}
+	}
+	return arg
+}
+
+// 长选项的值，支持 --name=value、--name value 和只写一个"-"的形式。
+// 值是下一个参数时 i 加1，没有值时返回false
+func longValue(args []string, i *int) (string, bool) {
+	if _, value, ok := strings.Cut(args[*i], "="); ok {
+		return value, true
+	}
+	if *i+1 >= len(args) {
+		return "", false
+	}
+	*i++
+	return args[*i], true
+}
+
+// 与本工具的输出采集或目标输入冲突的选项
+var conflictOptions = map[string]string{
+	"-iL":             "目标由本工具指定",
+	"-iR":             "目标由本工具指定",
+	"--resume":        "请使用本工具的 -resume",
+	"--append-output": "输出由本工具采集",
+	"--stylesheet":    "输出由本工具采集",
+	"--webxml":        "输出由本工具采集",
+}
+
+// 需要root权限的选项，没有权限时nmap会报错或改用其他扫描方式
+var privilegedOptions = map[string]string{
+	"-O":           "操作系统检测",
+	"-A":           "操作系统检测",
+	"-sS":          "SYN扫描",
+	"-sU":          "UDP扫描",
+	"-sA":          "ACK扫描",
+	"-sW":          "Window扫描",
+	"-sM":          "Maimon扫描",
+	"-sN":          "Null扫描",
+	"-sF":          "FIN扫描",
+	"-sX":          "Xmas扫描",
+	"-sY":          "SCTP INIT扫描",
+	"-sZ":          "SCTP COOKIE ECHO扫描",
+	"-sO":          "IP协议扫描",
+	"-sI":          "Idle扫描",
+	"-f":           "分片",
+	"-D":           "诱饵扫描",
+	"-S":           "伪造源地址",
+	"--spoof-mac":  "伪造MAC地址",
+	"--traceroute": "路由跟踪",
+}
+
+// ParseArgs 拆分并检查nmap参数。err 不为空表示参数不可用，
+// warnings 为可以继续扫描但需要提醒的问题，例如没有root权限时使用 -O
+func ParseArgs(s string) (args []string, warnings []string, err error) {
+	args, err = SplitArgs(s)
+	if err != nil {
+		return nil, nil, fmt.Errorf("nmap参数格式错误: %v", err)
+	}
+
+	explicitPrivileged := false
+	var needPrivilege []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		name := optionName(arg)
+
+		// -oN/-oX/-oS/-oG/-oA/-oM 可能带文件名，如 -oXresult.xml
+		if len(arg) >= 3 && arg[:2] == "-o" && strings.ContainsRune("NXSGAM", rune(arg[2])) {
+			return nil, nil, fmt.Errorf("nmap参数中不能包含输出选项 %s，输出由本工具采集", arg)
+		}
+		if reason, ok := conflictOptions[name]; ok {
+			return nil, nil, fmt.Errorf("nmap参数中不能包含 %s，%s", name, reason)
+		}
+		if name == "--privileged" {
+			explicitPrivileged = true
+		}
+		if desc, ok := privilegedOptions[name]; ok {
+			needPrivilege = append(needPrivilege, fmt.Sprintf("%s(%s)", name, desc))
+		}
+
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			return nil, nil, fmt.Errorf("nmap参数中不能包含扫描目标 %s，目标由本工具指定", arg)
+		}
+		if valueOptions[name] && (name == arg || name == "-"+arg) {
+			if i+1 >= len(args) {
+				return nil, nil, fmt.Errorf("nmap选项 %s 缺少参数值", arg)
+			}
+			i++
+		}
+	}
+
+	if len(needPrivilege) > 0 && !explicitPrivileged && !privileged() {
+		warnings = append(warnings, fmt.Sprintf("%s 需要root权限，当前用户运行时nmap可能报错或改用TCP connect扫描",
+			strings.Join(needPrivilege, "、")))
+	}
+	return args, warnings, nil
+}
+
+// 当前进程是否有root权限。Windows下是否可用取决于Npcap的安装方式，不做判断
+func privileged() bool {
+	if runtime.GOOS == "windows" {
+		return true
+	}
+	return os.Geteuid() == 0
+}
@@ -0,0 +1,73 @@
+package nmapscan
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		args string
+		want []string
+		err  string // 错误信息中应包含的内容，为空表示不出错
+	}{
+		{args: "", want: nil},
+		{args: "-sV -T4", want: []string{"-sV", "-T4"}},
+		{args: `--script "http-title,ssl-cert" -p 80,443`, want: []string{"--script", "http-title,ssl-cert", "-p", "80,443"}},
+		{args: "-p80,443 --top-ports=100", want: []string{"-p80,443", "--top-ports=100"}},
+		// 选项的值不是扫描目标
+		{args: "-T 4 -M 10", want: []string{"-T", "4", "-M", "10"}},
+		{args: "--script-help default", want: []string{"--script-help", "default"}},
+		{args: "--proxy socks4://127.0.0.1:1080", want: []string{"--proxy", "socks4://127.0.0.1:1080"}},
+		{args: "--nsock-engine epoll --route-dst 10.0.0.1", want: []string{"--nsock-engine", "epoll", "--route-dst", "10.0.0.1"}},
+		{args: "--exclude 10.0.0.1 --dns-servers 8.8.8.8", want: []string{"--exclude", "10.0.0.1", "--dns-servers", "8.8.8.8"}},
+		{args: "-sI 10.0.0.9 -Pn", want: []string{"-sI", "10.0.0.9", "-Pn"}},
+		// 长选项只写一个"-"
+		{args: "-host-timeout 5m -top-ports=20", want: []string{"-host-timeout", "5m", "-top-ports=20"}},
+
+		{args: "-sV 10.0.0.1", err: "扫描目标 10.0.0.1"},
+		{args: "-sV -", err: "扫描目标 -"},
+		{args: "-sV --host-timeout=5m 10.0.0.0/24", err: "扫描目标 10.0.0.0/24"},
+		{args: "--script", err: "缺少参数值"},
+		{args: "-oX out.xml", err: "输出选项 -oX"},
+		{args: "-oGresult.gnmap", err: "输出选项"},
+		{args: "-iL targets.txt", err: "不能包含 -iL"},
+		{args: "-iL=targets.txt", err: "不能包含 -iL"},
+		{args: "--resume=scan.log", err: "不能包含 --resume"},
+		{args: "-resume scan.log", err: "不能包含 --resume"},
+		{args: `--script "http-title`, err: "双引号未闭合"},
+	}
+	for _, tt := range tests {
+		args, _, err := ParseArgs(tt.args)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("ParseArgs(%q) 错误为 %v，应包含 %q", tt.args, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseArgs(%q) 出错: %v", tt.args, err)
+			continue
+		}
+		if !reflect.DeepEqual(args, tt.want) {
+			t.Errorf("ParseArgs(%q) = %q，应为 %q", tt.args, args, tt.want)
+		}
+	}
+}
+
+func TestParseArgsPrivileged(t *testing.T) {
+	if privileged() {
+		t.Skip("以root运行时不提醒")
+	}
+	_, warnings, err := ParseArgs("-sS -O")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "-sS(SYN扫描)、-O(操作系统检测)") {
+		t.Errorf("warnings = %q", warnings)
+	}
+	if _, warnings, _ := ParseArgs("-sS --privileged"); len(warnings) != 0 {
+		t.Errorf("使用 --privileged 时不应提醒，warnings = %q", warnings)
+	}
+}
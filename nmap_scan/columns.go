@@ -0,0 +1,155 @@
+package nmapscan
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Column 输入表格中的一列，按表头文字识别，Aliases 为可以识别的表头名称
+type Column struct {
+	Key      string
+	Aliases  []string
+	Required bool
+}
+
+// 输入表格的标准列
+const (
+	ColNumber = "number"
+	ColName   = "name"
+	ColDomain = "domain"
+	ColIP     = "ip"
+	ColPort   = "port"
+	ColRemark = "remark"
+)
+
+// InputColumns 返回标准列及默认别名，required 中的列为必需列
+func InputColumns(required ...string) []Column {
+	columns := []Column{
+		{Key: ColNumber, Aliases: []string{"所属单位", "序号", "单位", "单位名称", "编号", "number", "org", "organization"}},
+		{Key: ColName, Aliases: []string{"网站名称", "名称", "系统名称", "name"}},
+		{Key: ColDomain, Aliases: []string{"网站地址", "域名", "网址", "domain", "url", "website"}},
+		{Key: ColIP, Aliases: []string{"IP", "IP地址", "ip address", "主机", "目标", "host", "target"}},
+		{Key: ColPort, Aliases: []string{"端口", "端口号", "port", "ports"}},
+		{Key: ColRemark, Aliases: []string{"备注", "说明", "remark", "notes"}},
+	}
+	for i := range columns {
+		for _, key := range required {
+			if columns[i].Key == key {
+				columns[i].Required = true
+			}
+		}
+	}
+	return columns
+}
+
+// ParseColumnAliases 解析自定义别名，格式为 "ip=主机IP|目标地址;port=端口号"，
+// 自定义别名优先于默认别名
+func ParseColumnAliases(spec string, columns []Column) ([]Column, error) {
+	result := make([]Column, len(columns))
+	copy(result, columns)
+	for _, item := range strings.FieldsFunc(spec, func(r rune) bool { return r == ';' || r == '；' }) {
+		key, names, ok := strings.Cut(item, "=")
+		key = strings.ToLower(strings.TrimSpace(key))
+		if !ok || key == "" {
+			return nil, fmt.Errorf("列别名格式错误: %s", item)
+		}
+		found := false
+		for i := range result {
+			if result[i].Key != key {
+				continue
+			}
+			var aliases []string
+			for _, name := range strings.Split(names, "|") {
+				if name = strings.TrimSpace(name); name != "" {
+					aliases = append(aliases, name)
+				}
+			}
+			result[i].Aliases = append(aliases, result[i].Aliases...)
+			found = true
+		}
+		if !found {
+			return nil, fmt.Errorf("未知的列: %s", key)
+		}
+	}
+	return result, nil
+}
+
+// ColumnMap 列名到列序号(从0开始)的映射
+type ColumnMap map[string]int
+
+// 表头比较时忽略大小写、空白、下划线和连字符
+func normalizeHeader(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\t', '\n', '\r', '_', '-', '　':
+			return -1
+		}
+		return r
+	}, strings.ToLower(s))
+}
+
+// MapColumns 根据表头行定位各列，缺少必需列时返回的错误中列出所有缺少的列
+func MapColumns(header []string, columns []Column) (ColumnMap, error) {
+	m := make(ColumnMap)
+	for _, col := range columns {
+		// 按别名顺序匹配，同一别名出现多次时取第一列
+	alias:
+		for _, alias := range col.Aliases {
+			want := normalizeHeader(alias)
+			for i, h := range header {
+				if normalizeHeader(h) == want {
+					m[col.Key] = i
+					break alias
+				}
+			}
+		}
+	}
+
+	var missing []string
+	for _, col := range columns {
+		if _, ok := m[col.Key]; col.Required && !ok {
+			missing = append(missing, fmt.Sprintf("%s(可用表头: %s)", col.Key, strings.Join(col.Aliases, "、")))
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("缺少必需的列: %s; 表头为: %s", strings.Join(missing, ", "), strings.Join(header, "、"))
+	}
+	return m, nil
+}
+
+// Value 取一行中某列的值，没有该列或该行较短时返回空字符串
+func (m ColumnMap) Value(row []string, key string) string {
+	i, ok := m[key]
+	if !ok || i >= len(row) {
+		return ""
+	}
+	return strings.TrimSpace(row[i])
+}
+
+// SelectSheet 按名称或序号(从1开始)选择工作表，sel 为空时优先使用 Sheet1，没有则使用第一个工作表
+func SelectSheet(sheets []string, sel string) (string, error) {
+	if len(sheets) == 0 {
+		return "", fmt.Errorf("没有工作表")
+	}
+	if sel == "" {
+		for _, name := range sheets {
+			if name == "Sheet1" {
+				return name, nil
+			}
+		}
+		return sheets[0], nil
+	}
+	for _, name := range sheets {
+		if name == sel {
+			return name, nil
+		}
+	}
+	if n, err := strconv.Atoi(sel); err == nil {
+		if n < 1 || n > len(sheets) {
+			return "", fmt.Errorf("工作表序号 %d 超出范围(共%d个)", n, len(sheets))
+		}
+		return sheets[n-1], nil
+	}
+	return "", fmt.Errorf("没有名为 %s 的工作表，可用的工作表: %s", sel, strings.Join(sheets, "、"))
+}
@@ -0,0 +1,120 @@
+package nmapscan
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMapColumns(t *testing.T) {
+	columns := InputColumns(ColIP)
+	tests := []struct {
+		header []string
+		want   ColumnMap
+	}{
+		{
+			[]string{"所属单位", "网站名称", "网站地址", "IP", "端口", "备注"},
+			ColumnMap{ColNumber: 0, ColName: 1, ColDomain: 2, ColIP: 3, ColPort: 4, ColRemark: 5},
+		},
+		// 顺序不同、大小写和空白不同的英文表头
+		{
+			[]string{" Notes ", "URL", "IP_Address", "Org"},
+			ColumnMap{ColRemark: 0, ColDomain: 1, ColIP: 2, ColNumber: 3},
+		},
+		// 别名靠前的优先，同一别名出现多次时取第一列
+		{
+			[]string{"目标", "IP", "IP"},
+			ColumnMap{ColIP: 1},
+		},
+	}
+	for _, tt := range tests {
+		got, err := MapColumns(tt.header, columns)
+		if err != nil {
+			t.Errorf("MapColumns(%q): %v", tt.header, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("MapColumns(%q) = %v，应为 %v", tt.header, got, tt.want)
+		}
+	}
+
+	// 缺少必需列时列出所有缺少的列和表头
+	_, err := MapColumns([]string{"所属单位", "备注"}, InputColumns(ColIP, ColPort))
+	if err == nil {
+		t.Fatal("缺少IP和端口列时应返回错误")
+	}
+	for _, s := range []string{"缺少必需的列", "ip(可用表头: IP、", "port(可用表头: 端口、", "表头为: 所属单位、备注"} {
+		if !strings.Contains(err.Error(), s) {
+			t.Errorf("错误 %q 应包含 %q", err, s)
+		}
+	}
+
+	m := ColumnMap{ColIP: 1, ColRemark: 3}
+	row := []string{"单位A", " 10.0.0.1 "}
+	if ip, remark, port := m.Value(row, ColIP), m.Value(row, ColRemark), m.Value(row, ColPort); ip != "10.0.0.1" || remark != "" || port != "" {
+		t.Errorf("Value = %q %q %q", ip, remark, port)
+	}
+}
+
+func TestParseColumnAliases(t *testing.T) {
+	defaults := InputColumns(ColIP)
+	columns, err := ParseColumnAliases("IP=主机IP|目标地址；port = 开放端口", defaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := MapColumns([]string{"IP", "目标地址", "开放端口", "主机IP"}, columns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 自定义别名优先于默认别名
+	if want := (ColumnMap{ColIP: 3, ColPort: 2}); !reflect.DeepEqual(m, want) {
+		t.Errorf("自定义别名后 MapColumns = %v，应为 %v", m, want)
+	}
+	// 不修改传入的列
+	if !reflect.DeepEqual(defaults, InputColumns(ColIP)) {
+		t.Errorf("传入的列被修改: %v", defaults)
+	}
+
+	for _, spec := range []string{"主机IP", "=主机IP", "mac=MAC地址"} {
+		if _, err := ParseColumnAliases(spec, InputColumns()); err == nil {
+			t.Errorf("ParseColumnAliases(%q) 应返回错误", spec)
+		}
+	}
+	if columns, err := ParseColumnAliases("", InputColumns()); err != nil || !reflect.DeepEqual(columns, InputColumns()) {
+		t.Errorf("ParseColumnAliases(\"\") = %v, %v", columns, err)
+	}
+}
+
+func TestSelectSheet(t *testing.T) {
+	sheets := []string{"说明", "Sheet1", "2024"}
+	tests := []struct {
+		sheets []string
+		sel    string
+		want   string
+		err    string
+	}{
+		{sheets, "", "Sheet1", ""},
+		{[]string{"资产", "说明"}, "", "资产", ""},
+		{sheets, "说明", "说明", ""},
+		{sheets, "3", "2024", ""},
+		// 名称优先于序号
+		{sheets, "2024", "2024", ""},
+		{sheets, "1", "说明", ""},
+		{sheets, "4", "", "超出范围"},
+		{sheets, "0", "", "超出范围"},
+		{sheets, "资产", "", "可用的工作表: 说明、Sheet1、2024"},
+		{nil, "", "", "没有工作表"},
+	}
+	for _, tt := range tests {
+		got, err := SelectSheet(tt.sheets, tt.sel)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("SelectSheet(%q, %q) 错误 %v，应包含 %q", tt.sheets, tt.sel, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("SelectSheet(%q, %q) = %q, %v，应为 %q", tt.sheets, tt.sel, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,409 @@
+package nmapscan
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// NmapAvailable 本机能否找到nmap，path为空时从PATH中查找
+func NmapAvailable(path string) bool {
+	if path == "" {
+		path = "nmap"
+	}
+	_, err := exec.LookPath(path)
+	return err == nil
+}
+
+// ConnectScanner 不依赖nmap，用TCP connect探测端口，只能得到端口状态，没有服务版本
+// 和操作系统信息。端口取自参数中的 -p、--top-ports 或 -F，都没有时扫描常用的100个端口，
+// 设置了 --host-timeout 时超时后停止探测，只返回已探测的端口。其他nmap参数(包括UDP扫描)被忽略
+type ConnectScanner struct {
+	// Concurrency 同时进行的连接数，默认100
+	Concurrency int
+	// Timeout 单次连接的超时时间，默认2秒
+	Timeout time.Duration
+	// Retries 连接超时后的重试次数
+	Retries int
+
+	// 建立连接，为nil时使用 net.Dialer，测试时用于模拟超时
+	dial func(ctx context.Context, timeout time.Duration, addr string) (net.Conn, error)
+}
+
+// 与nmap一样，数量较多的 closed/filtered 端口只汇总数量，不逐个列出
+const maxListedPorts = 25
+
+func (s *ConnectScanner) Scan(ctx context.Context, target string, opts Options) (*Run, error) {
+	ports, spec, err := connectPorts(opts.Args)
+	if err != nil {
+		return nil, err
+	}
+	hostTimeout, err := HostTimeout(opts.Args)
+	if err != nil {
+		return nil, fmt.Errorf("--host-timeout 的值无效: %v", err)
+	}
+	ip, err := resolveTarget(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	run := &Run{
+		Scanner:  "connect",
+		Args:     strings.Join(append(append([]string{"connect"}, opts.Args...), target), " "),
+		Start:    start.Unix(),
+		ScanInfo: []Info{{Type: "connect", Protocol: "tcp", NumServices: len(ports), Services: spec}},
+	}
+
+	probeCtx := ctx
+	if hostTimeout > 0 {
+		var cancel context.CancelFunc
+		probeCtx, cancel = context.WithTimeout(ctx, hostTimeout)
+		defer cancel()
+	}
+	states := s.probe(probeCtx, ip, ports)
+
+	host := Host{
+		StartTime: start.Unix(),
+		Addresses: []Address{{Addr: ip, AddrType: addrType(ip)}},
+	}
+	if ip != target {
+		host.Hostnames = []Hostname{{Name: target, Type: "user"}}
+	}
+
+	var rtt time.Duration
+	var responded int
+	byState := make(map[string][]Port)
+	for _, st := range states {
+		if st.state == "" {
+			continue
+		}
+		if st.state == "open" {
+			rtt += st.rtt
+			responded++
+		}
+		byState[st.state] = append(byState[st.state], Port{
+			Protocol: "tcp",
+			PortID:   st.port,
+			State:    PortState{State: st.state, Reason: st.reason},
+			Service:  Service{Name: serviceName(st.port), Method: "table", Conf: 3},
+		})
+	}
+	for _, state := range []string{"open", "closed", "filtered"} {
+		list := byState[state]
+		if state == "open" || len(list) <= maxListedPorts {
+			host.Ports = append(host.Ports, list...)
+		} else {
+			host.ExtraPorts = append(host.ExtraPorts, ExtraPorts{State: state, Count: len(list)})
+		}
+	}
+	sort.Slice(host.Ports, func(i, j int) bool { return host.Ports[i].PortID < host.Ports[j].PortID })
+	if responded > 0 {
+		host.Times = &Times{SRTT: (rtt / time.Duration(responded)).Microseconds()}
+	}
+
+	// 没有单独的主机发现，有端口响应即认为主机在线
+	switch {
+	case hasArg(opts.Args, "-Pn"):
+		host.Status = Status{State: "up", Reason: "user-set"}
+	case len(byState["open"]) > 0:
+		host.Status = Status{State: "up", Reason: "syn-ack"}
+	case len(byState["closed"]) > 0:
+		host.Status = Status{State: "up", Reason: "conn-refused"}
+	default:
+		host.Status = Status{State: "down", Reason: "no-response"}
+	}
+
+	end := time.Now()
+	host.EndTime = end.Unix()
+	run.Hosts = []Host{host}
+	run.RunStats.Finished = Finished{Time: end.Unix(), Elapsed: end.Sub(start).Seconds(), Exit: "success"}
+	run.RunStats.Hosts = HostStats{Total: 1}
+	if host.Up() {
+		run.RunStats.Hosts.Up = 1
+	} else {
+		run.RunStats.Hosts.Down = 1
+	}
+
+	if err := ctx.Err(); err != nil {
+		run.Incomplete = true
+		run.RunStats.Finished.Exit = "error"
+		return run, err
+	}
+	run.RunStats.Finished.Summary = fmt.Sprintf("connect scan of %d ports done in %.2f seconds", len(ports), end.Sub(start).Seconds())
+	if probeCtx.Err() != nil {
+		// 与nmap一样，主机超时不作为错误
+		run.RunStats.Finished.Summary = fmt.Sprintf("connect scan of %s timed out after %s (--host-timeout)", target, hostTimeout)
+	}
+	return run, nil
+}
+
+// 单个端口的探测结果，state为空表示被中断未探测
+type portProbe struct {
+	port   int
+	state  string
+	reason string
+	rtt    time.Duration
+}
+
+// 用固定数量的goroutine依次探测所有端口
+func (s *ConnectScanner) probe(ctx context.Context, ip string, ports []int) []portProbe {
+	concurrency := s.Concurrency
+	if concurrency < 1 {
+		concurrency = 100
+	}
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+
+	results := make([]portProbe, len(ports))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency && w < len(ports); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results[i] = s.probePort(ctx, ip, ports[i], timeout)
+			}
+		}()
+	}
+	for i := range ports {
+		if ctx.Err() != nil {
+			break
+		}
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return results
+}
+
+func (s *ConnectScanner) probePort(ctx context.Context, ip string, port int, timeout time.Duration) portProbe {
+	result := portProbe{port: port}
+	dial := s.dial
+	if dial == nil {
+		dial = func(ctx context.Context, timeout time.Duration, addr string) (net.Conn, error) {
+			dialer := net.Dialer{Timeout: timeout}
+			return dialer.DialContext(ctx, "tcp", addr)
+		}
+	}
+	addr := net.JoinHostPort(ip, strconv.Itoa(port))
+	for attempt := 0; attempt <= s.Retries; attempt++ {
+		start := time.Now()
+		conn, err := dial(ctx, timeout, addr)
+		if ctx.Err() != nil {
+			if conn != nil {
+				conn.Close()
+			}
+			return portProbe{port: port}
+		}
+		switch {
+		case err == nil:
+			conn.Close()
+			result.state, result.reason, result.rtt = "open", "syn-ack", time.Since(start)
+			return result
+		case isAny(err, refusedErrors):
+			result.state, result.reason = "closed", "conn-refused"
+			return result
+		case isAny(err, unreachableErrors):
+			result.state, result.reason = "filtered", "host-unreach"
+			return result
+		}
+		// 超时或其他错误，重试后仍失败视为被过滤
+		result.state, result.reason = "filtered", "no-response"
+	}
+	return result
+}
+
+// Windows上返回的是WSA错误码
+var (
+	refusedErrors     = []error{syscall.ECONNREFUSED, syscall.Errno(10061)}
+	unreachableErrors = []error{syscall.EHOSTUNREACH, syscall.ENETUNREACH, syscall.Errno(10065), syscall.Errno(10051)}
+)
+
+func isAny(err error, targets []error) bool {
+	for _, target := range targets {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// 将主机名解析为IP，优先IPv4
+func resolveTarget(ctx context.Context, target string) (string, error) {
+	if net.ParseIP(target) != nil {
+		return target, nil
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, target)
+	if err != nil {
+		return "", fmt.Errorf("解析主机 %s 失败: %v", target, err)
+	}
+	for _, a := range addrs {
+		if a.IP.To4() != nil {
+			return a.IP.String(), nil
+		}
+	}
+	if len(addrs) == 0 {
+		return "", fmt.Errorf("解析主机 %s 失败: 没有地址", target)
+	}
+	return addrs[0].IP.String(), nil
+}
+
+func addrType(ip string) string {
+	if parsed := net.ParseIP(ip); parsed != nil && parsed.To4() == nil {
+		return "ipv6"
+	}
+	return "ipv4"
+}
+
+func hasArg(args []string, name string) bool {
+	for _, a := range args {
+		if a == name {
+			return true
+		}
+	}
+	return false
+}
+
+// 从nmap参数中取出要扫描的端口，同时返回端口说明(写入 <scaninfo>)
+func connectPorts(args []string) ([]int, string, error) {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "-p" && i+1 < len(args):
+			ports, err := ParsePorts(args[i+1])
+			return ports, args[i+1], err
+		case strings.HasPrefix(arg, "-p") && len(arg) > 2:
+			spec := strings.TrimPrefix(arg, "-p")
+			ports, err := ParsePorts(spec)
+			return ports, spec, err
+		case optionName(arg) == "--top-ports":
+			value, ok := longValue(args, &i)
+			if !ok {
+				break
+			}
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return nil, "", fmt.Errorf("--top-ports 的值无效: %s", value)
+			}
+			if n > len(topPorts) {
+				n = len(topPorts)
+			}
+			return sortedPorts(topPorts[:n]), "top " + strconv.Itoa(n), nil
+		case arg == "-F":
+			return sortedPorts(topPorts), "top 100", nil
+		}
+	}
+	return sortedPorts(topPorts), "top 100", nil
+}
+
+func sortedPorts(ports []int) []int {
+	sorted := append([]int{}, ports...)
+	sort.Ints(sorted)
+	return sorted
+}
+
+// ParsePorts 解析nmap格式的TCP端口列表，如 "22,80,8000-8100"、"-"(全部端口)、"T:22,U:53"
+// (只取TCP部分)
+func ParsePorts(spec string) ([]int, error) {
+	ports, err := parsePortSpec(spec, "T:")
+	if err == nil && len(ports) == 0 {
+		err = fmt.Errorf("端口列表 %q 中没有TCP端口", spec)
+	}
+	return ports, err
+}
+
+// 取出端口列表中某个协议(T:、U:、S:)的端口，没有协议前缀的部分适用于所有协议
+func parsePortSpec(spec, proto string) ([]int, error) {
+	seen := make(map[int]bool)
+	other := false
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		for _, prefix := range []string{"T:", "U:", "S:"} {
+			if strings.HasPrefix(part, prefix) {
+				other, part = prefix != proto, part[2:]
+			}
+		}
+		if other || part == "" {
+			continue
+		}
+
+		low, high, isRange := strings.Cut(part, "-")
+		from, to := 1, 65535
+		var err error
+		if low != "" {
+			if from, err = strconv.Atoi(low); err != nil {
+				return nil, fmt.Errorf("端口 %s 无效", part)
+			}
+		}
+		if !isRange {
+			to = from
+		} else if high != "" {
+			if to, err = strconv.Atoi(high); err != nil {
+				return nil, fmt.Errorf("端口 %s 无效", part)
+			}
+		}
+		if from < 1 || to > 65535 || from > to {
+			return nil, fmt.Errorf("端口 %s 超出范围", part)
+		}
+		for p := from; p <= to; p++ {
+			seen[p] = true
+		}
+	}
+	ports := make([]int, 0, len(seen))
+	for p := range seen {
+		ports = append(ports, p)
+	}
+	sort.Ints(ports)
+	return ports, nil
+}
+
+// 按常见程度排列的100个TCP端口，与 nmap -F 相同
+var topPorts = []int{
+	80, 23, 443, 21, 22, 25, 3389, 110, 445, 139, 143, 53, 135, 3306, 8080, 1723, 111, 995, 993, 5900,
+	1025, 587, 8888, 199, 1720, 465, 548, 113, 81, 6001, 10000, 514, 5060, 179, 1026, 2000, 8443, 8000, 32768, 554,
+	26, 1433, 49152, 2001, 515, 8008, 49154, 1027, 5666, 646, 5000, 5631, 631, 49153, 8081, 2049, 88, 79, 5800, 106,
+	2121, 1110, 49155, 6000, 513, 990, 5357, 427, 49156, 543, 544, 5101, 144, 7, 389, 8009, 3128, 444, 9999, 5009,
+	7070, 5190, 3000, 5432, 1900, 3986, 13, 1029, 9, 5051, 6646, 49157, 1028, 873, 1755, 2717, 4899, 9100, 119, 37,
+}
+
+// 常见端口的服务名称，与nmap-services一致，便于风险规则按服务名称匹配
+var services = map[int]string{
+	7: "echo", 9: "discard", 13: "daytime", 21: "ftp", 22: "ssh", 23: "telnet", 25: "smtp", 26: "rsftp",
+	37: "time", 53: "domain", 79: "finger", 80: "http", 81: "hosts2-ns", 88: "kerberos-sec", 106: "pop3pw",
+	110: "pop3", 111: "rpcbind", 113: "ident", 119: "nntp", 135: "msrpc", 139: "netbios-ssn", 143: "imap",
+	144: "news", 179: "bgp", 199: "smux", 389: "ldap", 427: "svrloc", 443: "https", 444: "snpp",
+	445: "microsoft-ds", 465: "smtps", 513: "login", 514: "shell", 515: "printer", 543: "klogin",
+	544: "kshell", 548: "afp", 554: "rtsp", 587: "submission", 631: "ipp", 636: "ldapssl", 646: "ldp",
+	873: "rsync", 990: "ftps", 993: "imaps", 995: "pop3s", 1025: "NFS-or-IIS", 1026: "LSA-or-nterm",
+	1027: "IIS", 1028: "unknown", 1029: "ms-lsa", 1110: "nfsd-status", 1433: "ms-sql-s", 1521: "oracle",
+	1720: "h323q931", 1723: "pptp", 1755: "wms", 1900: "upnp", 2000: "cisco-sccp", 2001: "dc",
+	2049: "nfs", 2121: "ccproxy-ftp", 2375: "docker", 2717: "pn-requester", 3000: "ppp", 3128: "squid-http",
+	3306: "mysql", 3389: "ms-wbt-server", 3986: "mapper-ws_ethd", 4899: "radmin", 5000: "upnp",
+	5009: "airport-admin", 5051: "ida-agent", 5060: "sip", 5101: "admdog", 5190: "aol", 5357: "wsdapi",
+	5432: "postgresql", 5631: "pcanywheredata", 5666: "nrpe", 5800: "vnc-http", 5900: "vnc",
+	5985: "wsman", 6000: "X11", 6001: "X11:1", 6379: "redis", 6646: "unknown", 7001: "afs3-callback",
+	7070: "realserver", 8000: "http-alt", 8008: "http", 8009: "ajp13", 8080: "http-proxy",
+	8081: "blackice-icecap", 8443: "https-alt", 8888: "sun-answerbook", 9100: "jetdirect",
+	9200: "wap-wsp", 9999: "abyss", 10000: "snet-sensor-mgmt", 11211: "memcache", 27017: "mongod",
+	32768: "filenet-tms", 49152: "unknown", 49153: "unknown", 49154: "unknown", 49155: "unknown",
+	49156: "unknown", 49157: "unknown",
+}
+
+func serviceName(port int) string {
+	if name, ok := services[port]; ok {
+		return name
+	}
+	return "unknown"
+}
@@ -0,0 +1,205 @@
+package nmapscan
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 在127.0.0.1上监听一个端口，测试结束时关闭
+func listen(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+// 一个没有监听的端口，连接会被拒绝
+func closedPort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+	return port
+}
+
+func portStates(run *Run) map[int]string {
+	states := make(map[int]string)
+	for _, p := range run.Hosts[0].Ports {
+		states[p.PortID] = p.State.State
+	}
+	return states
+}
+
+// 模拟没有响应：一直等到超时或被取消
+func noResponse(ctx context.Context, timeout time.Duration, addr string) (net.Conn, error) {
+	select {
+	case <-time.After(timeout):
+		return nil, &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("i/o timeout")}
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func TestConnectScannerOpenClosed(t *testing.T) {
+	open, closed := listen(t), closedPort(t)
+	s := &ConnectScanner{Timeout: time.Second}
+	args := []string{"-p", strconv.Itoa(open) + "," + strconv.Itoa(closed)}
+	run, err := s.Scan(context.Background(), "127.0.0.1", Options{Args: args})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.Incomplete || len(run.Hosts) != 1 {
+		t.Fatalf("结果 %+v", run)
+	}
+	host := run.Hosts[0]
+	if !host.Up() || host.Status.Reason != "syn-ack" {
+		t.Errorf("主机状态 %+v，应为 up/syn-ack", host.Status)
+	}
+	states := portStates(run)
+	if states[open] != "open" || states[closed] != "closed" {
+		t.Errorf("端口状态 %v，%d 应为 open，%d 应为 closed", states, open, closed)
+	}
+	if host.Times == nil {
+		t.Error("有开放端口时应记录延迟")
+	}
+}
+
+func TestConnectScannerDown(t *testing.T) {
+	s := &ConnectScanner{Timeout: 20 * time.Millisecond, dial: noResponse}
+	run, err := s.Scan(context.Background(), "127.0.0.1", Options{Args: []string{"-p", "1-30"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	host := run.Hosts[0]
+	if host.Up() {
+		t.Errorf("没有端口响应时主机应为 down，得到 %+v", host.Status)
+	}
+	// 超过25个的 filtered 端口只汇总数量
+	if len(host.Ports) != 0 || len(host.ExtraPorts) != 1 || host.ExtraPorts[0] != (ExtraPorts{State: "filtered", Count: 30}) {
+		t.Errorf("端口 %+v，汇总 %+v", host.Ports, host.ExtraPorts)
+	}
+
+	run, err = s.Scan(context.Background(), "127.0.0.1", Options{Args: []string{"-Pn", "-p", "1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st := run.Hosts[0].Status; st.State != "up" || st.Reason != "user-set" {
+		t.Errorf("-Pn 时主机状态 %+v，应为 up/user-set", st)
+	}
+}
+
+func TestConnectScannerRetries(t *testing.T) {
+	open := listen(t)
+	// 第一次连接超时，重试时连接到真实的监听端口
+	var attempts atomic.Int32
+	flaky := func(ctx context.Context, timeout time.Duration, addr string) (net.Conn, error) {
+		if attempts.Add(1) == 1 {
+			return noResponse(ctx, time.Millisecond, addr)
+		}
+		var d net.Dialer
+		return d.DialContext(ctx, "tcp", addr)
+	}
+	args := Options{Args: []string{"-p", strconv.Itoa(open)}}
+
+	for _, tt := range []struct {
+		retries  int
+		state    string
+		attempts int32
+	}{
+		{retries: 0, state: "filtered", attempts: 1},
+		{retries: 1, state: "open", attempts: 2},
+		{retries: 3, state: "open", attempts: 2},
+	} {
+		attempts.Store(0)
+		s := &ConnectScanner{Timeout: time.Second, Retries: tt.retries, dial: flaky}
+		run, err := s.Scan(context.Background(), "127.0.0.1", args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if state := portStates(run)[open]; state != tt.state || attempts.Load() != tt.attempts {
+			t.Errorf("Retries=%d: 状态 %q，连接 %d 次，应为 %q，%d 次", tt.retries, state, attempts.Load(), tt.state, tt.attempts)
+		}
+	}
+}
+
+func TestConnectScannerCancel(t *testing.T) {
+	open := listen(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &ConnectScanner{Concurrency: 2, Timeout: time.Minute, dial: func(ctx context.Context, timeout time.Duration, addr string) (net.Conn, error) {
+		if strings.HasSuffix(addr, ":"+strconv.Itoa(open)) {
+			var d net.Dialer
+			return d.DialContext(ctx, "tcp", addr)
+		}
+		cancel()
+		return noResponse(ctx, timeout, addr)
+	}}
+
+	start := time.Now()
+	run, err := s.Scan(ctx, "127.0.0.1", Options{Args: []string{"-p", strconv.Itoa(open) + ",1-1000"}})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("错误 %v，应为 context.Canceled", err)
+	}
+	if time.Since(start) > 10*time.Second {
+		t.Errorf("取消后用了 %s 才返回", time.Since(start))
+	}
+	if run == nil || !run.Incomplete || run.RunStats.Finished.Exit != "error" {
+		t.Fatalf("被中断的结果应标记为 Incomplete，得到 %+v", run)
+	}
+	for _, p := range run.Hosts[0].Ports {
+		if p.State.State != "open" && p.State.State != "closed" {
+			t.Errorf("被中断的端口 %d 不应出现在结果中: %s", p.PortID, p.State.State)
+		}
+	}
+}
+
+func TestConnectScannerHostTimeout(t *testing.T) {
+	s := &ConnectScanner{Concurrency: 10, Timeout: time.Minute, dial: noResponse}
+	start := time.Now()
+	run, err := s.Scan(context.Background(), "127.0.0.1", Options{Args: []string{"-Pn", "-p-", "--host-timeout=200ms"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("--host-timeout=200ms 时用了 %s", elapsed)
+	}
+	if run.Incomplete || !strings.Contains(run.RunStats.Finished.Summary, "timed out") {
+		t.Errorf("主机超时的结果 Incomplete=%v，说明 %q", run.Incomplete, run.RunStats.Finished.Summary)
+	}
+
+	if _, err := s.Scan(context.Background(), "127.0.0.1", Options{Args: []string{"--host-timeout", "abc"}}); err == nil {
+		t.Error("--host-timeout 无效时应返回错误")
+	}
+}
+
+func TestConnectScannerMaxDuration(t *testing.T) {
+	s := &ConnectScanner{Concurrency: 10, Timeout: 2 * time.Second, Retries: 1}
+	ports, worst, err := s.MaxDuration(Options{Args: []string{"-p", "1-100"}})
+	if err != nil || ports != 100 || worst != 40*time.Second {
+		t.Errorf("MaxDuration = %d, %s, %v，应为 100, 40s", ports, worst, err)
+	}
+	_, worst, err = s.MaxDuration(Options{Args: []string{"-p", "1-100", "--host-timeout", "30s"}})
+	if err != nil || worst != 30*time.Second {
+		t.Errorf("有 --host-timeout 时 MaxDuration = %s, %v，应为 30s", worst, err)
+	}
+}
@@ -0,0 +1,143 @@
+package nmapscan
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// nmap默认扫描最常用的1000个端口
+const defaultPortCount = 1000
+
+// PortCount 按nmap参数估算每个主机扫描的TCP、UDP端口数，用于 -plan 估算扫描量。
+// 端口取自 -p、--top-ports、-F，都没有时为1000个；没有指定扫描类型时扫描TCP，
+// -sU 扫描UDP，-sn 不扫描端口。--exclude-ports 不计算在内
+func PortCount(args []string) (tcp, udp int, err error) {
+	scanTCP, scanUDP, noPorts := false, false, false
+	spec, top := "", defaultPortCount
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		name := optionName(arg)
+		switch {
+		case name == "--top-ports":
+			value, ok := longValue(args, &i)
+			if !ok {
+				break
+			}
+			if top, err = strconv.Atoi(value); err != nil || top < 1 {
+				return 0, 0, fmt.Errorf("--top-ports 的值无效: %s", value)
+			}
+			top = min(top, 65535)
+		case strings.HasPrefix(name, "--"):
+			// 其他选项的值不能当作扫描类型或端口，如 --script-args -sU
+			if valueOptions[name] && !strings.Contains(arg, "=") {
+				i++
+			}
+		case arg == "-sn":
+			noPorts = true
+		case strings.HasPrefix(arg, "-s") && len(arg) > 2:
+			// 扫描类型可以合写，如 -sSU
+			for _, c := range arg[2:] {
+				switch c {
+				case 'S', 'T', 'A', 'W', 'M', 'N', 'F', 'X':
+					scanTCP = true
+				case 'U':
+					scanUDP = true
+				}
+			}
+		case arg == "-p" && i+1 < len(args):
+			i++
+			spec = args[i]
+		case strings.HasPrefix(arg, "-p") && len(arg) > 2:
+			spec = strings.TrimPrefix(arg, "-p")
+		case arg == "-F":
+			top = 100
+		}
+	}
+	if noPorts {
+		return 0, 0, nil
+	}
+	if !scanUDP {
+		scanTCP = true
+	}
+
+	count := func(proto string) (int, error) {
+		if spec == "" {
+			return top, nil
+		}
+		ports, err := parsePortSpec(spec, proto)
+		return len(ports), err
+	}
+	if scanTCP {
+		if tcp, err = count("T:"); err != nil {
+			return 0, 0, err
+		}
+	}
+	if scanUDP {
+		if udp, err = count("U:"); err != nil {
+			return 0, 0, err
+		}
+	}
+	return tcp, udp, nil
+}
+
+// HostTimeout 参数中 --host-timeout 的值，没有设置时返回0
+func HostTimeout(args []string) (time.Duration, error) {
+	for i := 0; i < len(args); i++ {
+		if optionName(args[i]) != "--host-timeout" {
+			continue
+		}
+		if value, ok := longValue(args, &i); ok {
+			return parseTimeSpec(value)
+		}
+	}
+	return 0, nil
+}
+
+// 解析nmap的时间格式，如 "58m"、"30s"、"500ms"、"2h"，没有单位时为秒
+func parseTimeSpec(s string) (time.Duration, error) {
+	units := []struct {
+		suffix string
+		unit   time.Duration
+	}{{"ms", time.Millisecond}, {"s", time.Second}, {"m", time.Minute}, {"h", time.Hour}}
+	value, unit := s, time.Second
+	for _, u := range units {
+		if strings.HasSuffix(s, u.suffix) {
+			value, unit = strings.TrimSuffix(s, u.suffix), u.unit
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("时间 %q 无效", s)
+	}
+	return time.Duration(n * float64(unit)), nil
+}
+
+// MaxDuration 内置扫描单个主机最长的耗时：所有端口都超时且重试，按同时连接数分批，
+// 不超过 --host-timeout
+func (s *ConnectScanner) MaxDuration(opts Options) (ports int, worst time.Duration, err error) {
+	list, _, err := connectPorts(opts.Args)
+	if err != nil {
+		return 0, 0, err
+	}
+	concurrency := s.Concurrency
+	if concurrency < 1 {
+		concurrency = 100
+	}
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+	rounds := (len(list) + concurrency - 1) / concurrency
+	worst = time.Duration(rounds*(s.Retries+1)) * timeout
+	hostTimeout, err := HostTimeout(opts.Args)
+	if err != nil {
+		return 0, 0, err
+	}
+	if hostTimeout > 0 && hostTimeout < worst {
+		worst = hostTimeout
+	}
+	return len(list), worst, nil
+}
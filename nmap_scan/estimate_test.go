@@ -0,0 +1,78 @@
+package nmapscan
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPortCount(t *testing.T) {
+	tests := []struct {
+		args     string
+		tcp, udp int
+		err      bool
+	}{
+		{args: "", tcp: 1000},
+		{args: "-sV -O", tcp: 1000},
+		{args: "-p 1-65535", tcp: 65535},
+		{args: "-p-", tcp: 65535},
+		{args: "-p22,80,443", tcp: 3},
+		{args: "-F", tcp: 100},
+		{args: "--top-ports 20", tcp: 20},
+		{args: "--top-ports=20", tcp: 20},
+		{args: "-top-ports=20", tcp: 20},
+		{args: "--top-ports=100000", tcp: 65535},
+		{args: "--top-ports=0", err: true},
+		{args: "--top-ports abc", err: true},
+		{args: "-sU --top-ports=50", udp: 50},
+		{args: "-sSU -p T:22,80,U:53", tcp: 2, udp: 1},
+		{args: "-sS -sU -p U:53,161", tcp: 0, udp: 2},
+		{args: "-sn", tcp: 0},
+		{args: "-sV --exclude-ports=25 -p 1-100", tcp: 100},
+		// 其他选项的值不当作扫描类型
+		{args: "--script-args -sU -p 80", tcp: 1},
+		{args: "-p 70000", err: true},
+	}
+	for _, tt := range tests {
+		tcp, udp, err := PortCount(strings.Fields(tt.args))
+		if tt.err {
+			if err == nil {
+				t.Errorf("PortCount(%q) 应返回错误", tt.args)
+			}
+			continue
+		}
+		if err != nil || tcp != tt.tcp || udp != tt.udp {
+			t.Errorf("PortCount(%q) = %d, %d, %v，应为 %d, %d", tt.args, tcp, udp, err, tt.tcp, tt.udp)
+		}
+	}
+}
+
+func TestHostTimeout(t *testing.T) {
+	tests := []struct {
+		args string
+		want time.Duration
+		err  bool
+	}{
+		{args: "-sV", want: 0},
+		{args: "-sV --host-timeout 58m", want: 58 * time.Minute},
+		{args: "-sV --host-timeout=58m", want: 58 * time.Minute},
+		{args: "-host-timeout=90s", want: 90 * time.Second},
+		{args: "--host-timeout 1.5h", want: 90 * time.Minute},
+		{args: "--host-timeout=500ms", want: 500 * time.Millisecond},
+		{args: "--host-timeout 30", want: 30 * time.Second},
+		{args: "--host-timeout", want: 0},
+		{args: "--host-timeout=abc", err: true},
+	}
+	for _, tt := range tests {
+		got, err := HostTimeout(strings.Fields(tt.args))
+		if tt.err {
+			if err == nil {
+				t.Errorf("HostTimeout(%q) 应返回错误", tt.args)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("HostTimeout(%q) = %v, %v，应为 %v", tt.args, got, err, tt.want)
+		}
+	}
+}
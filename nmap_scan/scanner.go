@@ -0,0 +1,237 @@
+package nmapscan
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Options 单次扫描的参数
+type Options struct {
+	// Args 为nmap参数，不含 -oX 和扫描目标
+	Args []string
+}
+
+// Scanner 扫描单个目标。ctx取消时应尽快返回，并尽量返回已得到的部分结果和ctx的错误
+type Scanner interface {
+	Scan(ctx context.Context, target string, opts Options) (*Run, error)
+}
+
+// BatchScanner 在一次扫描中扫描多个目标，返回的结果包含所有主机，可用 SplitRun 按目标拆分
+type BatchScanner interface {
+	ScanBatch(ctx context.Context, targets []string, opts Options) (*Run, error)
+}
+
+// ExecScanner 调用本机的nmap，使用 -oX - 获取XML结果
+type ExecScanner struct {
+	// Path 为nmap可执行文件路径，为空时从PATH中查找
+	Path string
+	// RecordDir 不为空时将每个目标的原始XML保存到该目录，供 ReplayScanner 回放
+	RecordDir string
+}
+
+func (s *ExecScanner) Scan(ctx context.Context, target string, opts Options) (*Run, error) {
+	args := append(append([]string{}, opts.Args...), "-oX", "-", target)
+	return s.exec(ctx, args, replayFilename(target))
+}
+
+// ScanBatch 将目标写入临时文件，通过 -iL 交给一个nmap进程扫描
+func (s *ExecScanner) ScanBatch(ctx context.Context, targets []string, opts Options) (*Run, error) {
+	file, err := os.CreateTemp("", "nmap-targets-*.txt")
+	if err != nil {
+		return nil, fmt.Errorf("创建目标文件失败: %v", err)
+	}
+	defer os.Remove(file.Name())
+	_, err = file.WriteString(strings.Join(targets, "\n") + "\n")
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("写入目标文件失败: %v", err)
+	}
+
+	args := append(append([]string{}, opts.Args...), "-oX", "-", "-iL", file.Name())
+	// 录制时整批保存为一个文件，ReplayScanner 按主机地址查找
+	return s.exec(ctx, args, replayFilename(fmt.Sprintf("batch_%s_%d", targets[0], len(targets))))
+}
+
+func (s *ExecScanner) exec(ctx context.Context, args []string, recordName string) (*Run, error) {
+	path := s.Path
+	if path == "" {
+		path = "nmap"
+	}
+	cmd := exec.CommandContext(ctx, path, args...)
+	// 取消时先发送中断信号让nmap自行退出，超时后再强制结束
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(os.Interrupt)
+	}
+	cmd.WaitDelay = 10 * time.Second
+
+	// XML输出到stdout，警告和错误信息单独收集
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	runErr := cmd.Run()
+
+	if s.RecordDir != "" && stdout.Len() > 0 {
+		if err := os.WriteFile(filepath.Join(s.RecordDir, recordName), stdout.Bytes(), 0644); err != nil {
+			return nil, fmt.Errorf("保存扫描结果失败: %v", err)
+		}
+	}
+
+	if runErr != nil {
+		if ctx.Err() != nil {
+			// 被中断时解析已输出的部分结果
+			run, _ := ParsePartialXML(stdout.Bytes())
+			return run, ctx.Err()
+		}
+		return nil, fmt.Errorf("%v %s", runErr, strings.TrimSpace(stderr.String()))
+	}
+	return ParsePartialXML(stdout.Bytes())
+}
+
+// ReplayScanner 从目录中读取录制好的nmap XML输出，不执行nmap，用于离线测试。
+// 优先读取 <目标>.xml (IPv6地址中的":"替换为"_")，不存在时在目录下所有
+// .xml 文件中查找地址匹配的主机
+type ReplayScanner struct {
+	Dir string
+
+	once  sync.Once
+	index map[string]*Run
+	err   error
+}
+
+// 录制文件名，IPv6地址中的":"在部分文件系统中不可用
+func replayFilename(target string) string {
+	return strings.NewReplacer(":", "_", "/", "_").Replace(target) + ".xml"
+}
+
+func (s *ReplayScanner) Scan(ctx context.Context, target string, opts Options) (*Run, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(filepath.Join(s.Dir, replayFilename(target)))
+	if err == nil {
+		return ParsePartialXML(data)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("读取录制结果失败: %v", err)
+	}
+
+	s.once.Do(s.buildIndex)
+	if s.err != nil {
+		return nil, s.err
+	}
+	if run, ok := s.index[target]; ok {
+		return run, nil
+	}
+	return nil, fmt.Errorf("没有 %s 的录制结果", target)
+}
+
+// ScanBatch 逐个读取目标的录制结果并合并，与nmap一样不包含离线的主机
+func (s *ReplayScanner) ScanBatch(ctx context.Context, targets []string, opts Options) (*Run, error) {
+	var merged *Run
+	for _, target := range targets {
+		run, err := s.Scan(ctx, target, opts)
+		if err != nil {
+			return nil, err
+		}
+		if merged == nil {
+			copied := *run
+			copied.Hosts = nil
+			copied.RunStats.Hosts = HostStats{}
+			merged = &copied
+		}
+		merged.Hosts = append(merged.Hosts, run.Hosts...)
+		merged.RunStats.Hosts.Up += run.RunStats.Hosts.Up
+		merged.RunStats.Hosts.Down += run.RunStats.Hosts.Down
+		merged.RunStats.Hosts.Total += run.RunStats.Hosts.Total
+	}
+	return merged, nil
+}
+
+// SplitRun 将一次扫描多个目标的结果按目标拆分，顺序与targets一致，每个结果最多包含一个主机。
+// 按IP地址或主机名匹配主机；nmap不输出离线的主机，没有对应主机的目标在扫描完成时
+// 记为离线，扫描被中断时标记为 Incomplete
+func SplitRun(run *Run, targets []string) []*Run {
+	index := make(map[string]int)
+	for i, host := range run.Hosts {
+		for _, a := range host.Addresses {
+			if a.AddrType != "mac" {
+				index[targetKey(a.Addr)] = i
+			}
+		}
+		for _, name := range host.Hostnames {
+			index[targetKey(name.Name)] = i
+		}
+	}
+
+	runs := make([]*Run, len(targets))
+	for i, target := range targets {
+		single := *run
+		single.Hosts = nil
+		single.RunStats.Hosts = HostStats{Total: 1}
+		if hostIndex, ok := index[targetKey(target)]; ok {
+			host := run.Hosts[hostIndex]
+			single.Hosts = []Host{host}
+			single.Incomplete = false
+			if host.Up() {
+				single.RunStats.Hosts.Up = 1
+			} else {
+				single.RunStats.Hosts.Down = 1
+			}
+		} else if !run.Incomplete {
+			single.RunStats.Hosts.Down = 1
+		}
+		runs[i] = &single
+	}
+	return runs
+}
+
+// 地址统一为标准写法(IPv6有多种写法)，主机名不区分大小写
+func targetKey(s string) string {
+	if ip := net.ParseIP(s); ip != nil {
+		return ip.String()
+	}
+	return strings.ToLower(s)
+}
+
+// 读取目录下所有录制文件，按主机地址建立索引
+func (s *ReplayScanner) buildIndex() {
+	s.index = make(map[string]*Run)
+	files, err := filepath.Glob(filepath.Join(s.Dir, "*.xml"))
+	if err != nil {
+		s.err = err
+		return
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			s.err = fmt.Errorf("读取录制结果失败: %v", err)
+			return
+		}
+		run, err := ParsePartialXML(data)
+		if err != nil {
+			continue
+		}
+		for _, host := range run.Hosts {
+			single := *run
+			single.Hosts = []Host{host}
+			for _, addr := range host.Addresses {
+				s.index[addr.Addr] = &single
+			}
+			for _, name := range host.Hostnames {
+				s.index[name.Name] = &single
+			}
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package nmapscan
+
+import (
+	"strings"
+	"testing"
+)
+
+// 拼接一次扫描的XML，finished为false时模拟nmap被中断，输出在最后一个主机后截断
+func batchXML(finished bool, hosts ...string) []byte {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<nmaprun scanner="nmap" args="nmap -sV -oX - -iL -" start="1792030323" version="7.94" xmloutputversion="1.05">
+`)
+	for _, host := range hosts {
+		b.WriteString(host + "\n")
+	}
+	if finished {
+		b.WriteString(`<runstats><finished time="1792030341" elapsed="18.21" exit="success"/><hosts up="1" down="0" total="1"/></runstats>
+</nmaprun>
+`)
+	} else {
+		b.WriteString(`<host starttime="1792030330"><status state="up" reason="echo-reply"/>`)
+	}
+	return []byte(b.String())
+}
+
+func hostXML(state, addr, hostname string) string {
+	return `<host starttime="1792030323" endtime="1792030341"><status state="` + state + `" reason="echo-reply"/>` +
+		`<address addr="` + addr + `" addrtype="` + addrType(addr) + `"/>` +
+		`<hostnames><hostname name="` + hostname + `" type="user"/></hostnames>` +
+		`<ports><port protocol="tcp" portid="80"><state state="open" reason="syn-ack"/><service name="http"/></port></ports></host>`
+}
+
+func TestSplitRun(t *testing.T) {
+	cidr, err := ExpandTargets("192.0.2.0/30")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 拆分后每个目标的结果: 匹配到的主机地址，为空表示没有主机
+	type split struct {
+		addr             string
+		up, down         int
+		incomplete, open bool
+	}
+	tests := []struct {
+		name    string
+		xml     []byte
+		targets []string
+		want    []split
+	}{
+		{
+			name:    "顺序与targets一致",
+			xml:     batchXML(true, hostXML("up", "10.0.0.1", ""), hostXML("up", "10.0.0.2", "")),
+			targets: []string{"10.0.0.2", "10.0.0.1"},
+			want:    []split{{addr: "10.0.0.2", up: 1, open: true}, {addr: "10.0.0.1", up: 1, open: true}},
+		},
+		{
+			// -Pn 等情况下nmap输出离线的主机；默认不输出，扫描完成时没有主机的目标视为离线
+			name:    "离线或不在XML中的主机",
+			xml:     batchXML(true, hostXML("down", "10.0.0.1", "")),
+			targets: []string{"10.0.0.1", "10.0.0.2"},
+			want:    []split{{addr: "10.0.0.1", down: 1, open: true}, {down: 1}},
+		},
+		{
+			name:    "主机名目标",
+			xml:     batchXML(true, hostXML("up", "10.0.0.1", "www.example.test")),
+			targets: []string{"WWW.Example.test"},
+			want:    []split{{addr: "10.0.0.1", up: 1, open: true}},
+		},
+		{
+			name:    "IPv6地址写法不同",
+			xml:     batchXML(true, hostXML("up", "2001:db8::1", "")),
+			targets: []string{"2001:db8:0::0:1"},
+			want:    []split{{addr: "2001:db8::1", up: 1, open: true}},
+		},
+		{
+			// 网段展开后逐个主机对应结果
+			name:    "网段目标",
+			xml:     batchXML(true, hostXML("up", "192.0.2.1", ""), hostXML("up", "192.0.2.2", "")),
+			targets: cidr,
+			want: []split{
+				{down: 1},
+				{addr: "192.0.2.1", up: 1, open: true},
+				{addr: "192.0.2.2", up: 1, open: true},
+				{down: 1},
+			},
+		},
+		{
+			// 已完整输出的主机有效，其余目标可能尚未扫描，不能视为离线
+			name:    "扫描被中断",
+			xml:     batchXML(false, hostXML("up", "10.0.0.1", "")),
+			targets: []string{"10.0.0.1", "10.0.0.2"},
+			want:    []split{{addr: "10.0.0.1", up: 1, open: true}, {incomplete: true}},
+		},
+	}
+	for _, tt := range tests {
+		run, err := ParsePartialXML(tt.xml)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		runs := SplitRun(run, tt.targets)
+		if len(runs) != len(tt.want) {
+			t.Fatalf("%s: 拆分为 %d 个结果，应为 %d 个", tt.name, len(runs), len(tt.want))
+		}
+		for i, w := range tt.want {
+			single := runs[i]
+			got := split{
+				up:         single.RunStats.Hosts.Up,
+				down:       single.RunStats.Hosts.Down,
+				incomplete: single.Incomplete,
+			}
+			if len(single.Hosts) > 1 {
+				t.Errorf("%s: %s 对应 %d 个主机", tt.name, tt.targets[i], len(single.Hosts))
+			}
+			if len(single.Hosts) == 1 {
+				got.addr = single.Hosts[0].Addr()
+				got.open = len(single.Hosts[0].Ports) == 1
+			}
+			if got != w {
+				t.Errorf("%s: %s 的结果 = %+v，应为 %+v", tt.name, tt.targets[i], got, w)
+			}
+			if single.RunStats.Hosts.Total != 1 || single.Args != run.Args {
+				t.Errorf("%s: %s 的结果 total=%d args=%q", tt.name, tt.targets[i], single.RunStats.Hosts.Total, single.Args)
+			}
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package nmapscan
+
+import (
+	"fmt"
+	"net/netip"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// MaxExpand 单个目标最多展开的主机数，防止误写的大网段(如 10.0.0.0/8)被逐个扫描
+const MaxExpand = 65536
+
+var hostnameRegex = regexp.MustCompile(`^[A-Za-z0-9_]([A-Za-z0-9_-]*[A-Za-z0-9_])?(\.[A-Za-z0-9_]([A-Za-z0-9_-]*[A-Za-z0-9_])?)*\.?$`)
+
+// SplitTargets 将一个单元格或命令行中的目标拆分为单个目标说明。
+// 空白、分号分隔的各项分别处理；含逗号的项如果是合法的 nmap 八位组写法
+// (如 10.1.2.1,3,5) 则保持原样，否则按逗号拆分 (如 10.1.2.1,10.1.2.5)
+func SplitTargets(spec string) []string {
+	var targets []string
+	fields := strings.FieldsFunc(spec, func(r rune) bool {
+		return r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == ';' || r == '，' || r == '；'
+	})
+	for _, field := range fields {
+		if strings.Contains(field, ",") {
+			if _, err := expandOctets(field); err != nil {
+				for _, t := range strings.Split(field, ",") {
+					if t = strings.TrimSpace(t); t != "" {
+						targets = append(targets, t)
+					}
+				}
+				continue
+			}
+		}
+		targets = append(targets, field)
+	}
+	return targets
+}
+
+// ExpandTargets 将 nmap 风格的目标说明展开为单个主机并去重，支持:
+//   - 单个 IPv4/IPv6 地址
+//   - CIDR，如 10.1.2.0/24、fd00::/120
+//   - 八位组范围和列表，如 10.1.2.10-20、10.1.1-2.1,3、10.1.2.*
+//   - 主机名，原样保留
+func ExpandTargets(spec string) ([]string, error) {
+	var hosts []string
+	seen := make(map[string]bool)
+	for _, target := range SplitTargets(spec) {
+		expanded, err := expandTarget(target)
+		if err != nil {
+			return nil, err
+		}
+		for _, host := range expanded {
+			if !seen[host] {
+				seen[host] = true
+				hosts = append(hosts, host)
+			}
+		}
+	}
+	return hosts, nil
+}
+
+func expandTarget(target string) ([]string, error) {
+	// 单个IP，统一为规范写法，便于去重
+	if addr, err := netip.ParseAddr(strings.Trim(target, "[]")); err == nil {
+		return []string{addr.String()}, nil
+	}
+
+	if strings.Contains(target, "/") {
+		return expandCIDR(target)
+	}
+
+	if hosts, err := expandOctets(target); err == nil {
+		return hosts, nil
+	} else if looksLikeIPv4(target) {
+		return nil, fmt.Errorf("无效的目标 %q: %v", target, err)
+	}
+
+	if hostnameRegex.MatchString(target) {
+		return []string{strings.ToLower(strings.TrimSuffix(target, "."))}, nil
+	}
+	return nil, fmt.Errorf("无效的目标 %q", target)
+}
+
+// 展开CIDR网段，与nmap一致包含网络地址和广播地址
+func expandCIDR(target string) ([]string, error) {
+	prefix, err := netip.ParsePrefix(target)
+	if err != nil {
+		return nil, fmt.Errorf("无效的网段 %q: %v", target, err)
+	}
+	hostBits := prefix.Addr().BitLen() - prefix.Bits()
+	if hostBits > 16 || 1<<hostBits > MaxExpand {
+		return nil, fmt.Errorf("网段 %q 过大，最多展开 %d 个地址", target, MaxExpand)
+	}
+
+	prefix = prefix.Masked()
+	hosts := make([]string, 0, 1<<hostBits)
+	addr := prefix.Addr()
+	for i := 0; i < 1<<hostBits; i++ {
+		hosts = append(hosts, addr.String())
+		addr = addr.Next()
+	}
+	return hosts, nil
+}
+
+// 形如 a.b.c.d 且每段只含数字、"-"、","、"*" 的目标
+func looksLikeIPv4(target string) bool {
+	parts := strings.Split(target, ".")
+	if len(parts) != 4 {
+		return false
+	}
+	for _, part := range parts {
+		if strings.Trim(part, "0123456789-,*") != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// 展开 nmap 八位组写法，如 10.1.1-2.1,3
+func expandOctets(target string) ([]string, error) {
+	parts := strings.Split(target, ".")
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("需要4个八位组")
+	}
+
+	octets := make([][]int, 4)
+	total := 1
+	for i, part := range parts {
+		values, err := parseOctet(part)
+		if err != nil {
+			return nil, err
+		}
+		octets[i] = values
+		total *= len(values)
+		if total > MaxExpand {
+			return nil, fmt.Errorf("范围过大，最多展开 %d 个地址", MaxExpand)
+		}
+	}
+
+	hosts := make([]string, 0, total)
+	for _, a := range octets[0] {
+		for _, b := range octets[1] {
+			for _, c := range octets[2] {
+				for _, d := range octets[3] {
+					hosts = append(hosts, fmt.Sprintf("%d.%d.%d.%d", a, b, c, d))
+				}
+			}
+		}
+	}
+	return hosts, nil
+}
+
+// 解析单个八位组: 数字、a-b、-b、a-、* 以及它们的逗号列表
+func parseOctet(part string) ([]int, error) {
+	var values []int
+	seen := make(map[int]bool)
+	for _, item := range strings.Split(part, ",") {
+		lo, hi := 0, 255
+		switch {
+		case item == "*" || item == "-":
+		case strings.Contains(item, "-"):
+			bounds := strings.SplitN(item, "-", 2)
+			var err error
+			if bounds[0] != "" {
+				if lo, err = parseOctetValue(bounds[0]); err != nil {
+					return nil, err
+				}
+			}
+			if bounds[1] != "" {
+				if hi, err = parseOctetValue(bounds[1]); err != nil {
+					return nil, err
+				}
+			}
+			if lo > hi {
+				return nil, fmt.Errorf("范围 %q 起始值大于结束值", item)
+			}
+		default:
+			v, err := parseOctetValue(item)
+			if err != nil {
+				return nil, err
+			}
+			lo, hi = v, v
+		}
+		for v := lo; v <= hi; v++ {
+			if !seen[v] {
+				seen[v] = true
+				values = append(values, v)
+			}
+		}
+	}
+	return values, nil
+}
+
+func parseOctetValue(s string) (int, error) {
+	v, err := strconv.Atoi(s)
+	if err != nil || v < 0 || v > 255 {
+		return 0, fmt.Errorf("无效的八位组 %q", s)
+	}
+	return v, nil
+}
@@ -0,0 +1,85 @@
+package nmapscan
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitTargets(t *testing.T) {
+	tests := []struct {
+		spec string
+		want []string
+	}{
+		{"10.0.0.1", []string{"10.0.0.1"}},
+		{"10.0.0.1 10.0.0.2;10.0.0.3", []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}},
+		{"10.0.0.1，10.0.0.2；10.0.0.3", []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}},
+		// 合法的八位组列表保持原样
+		{"10.1.2.1,3,5", []string{"10.1.2.1,3,5"}},
+		{"10.1.2.1,10.1.2.5", []string{"10.1.2.1", "10.1.2.5"}},
+		{"www.example.com,10.0.0.1", []string{"www.example.com", "10.0.0.1"}},
+		{"  ", nil},
+	}
+	for _, tt := range tests {
+		if got := SplitTargets(tt.spec); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SplitTargets(%q) = %q，应为 %q", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestExpandTargets(t *testing.T) {
+	tests := []struct {
+		spec string
+		want []string
+	}{
+		{"10.0.0.1", []string{"10.0.0.1"}},
+		{"10.1.2.0/30", []string{"10.1.2.0", "10.1.2.1", "10.1.2.2", "10.1.2.3"}},
+		// 非网络地址的CIDR按网段展开
+		{"10.1.2.3/31", []string{"10.1.2.2", "10.1.2.3"}},
+		{"10.1.2.10-12", []string{"10.1.2.10", "10.1.2.11", "10.1.2.12"}},
+		{"10.1.1-2.1,3", []string{"10.1.1.1", "10.1.1.3", "10.1.2.1", "10.1.2.3"}},
+		{"10.1.2.254-", []string{"10.1.2.254", "10.1.2.255"}},
+		{"10.1.2.-1", []string{"10.1.2.0", "10.1.2.1"}},
+		// 去重，包括同一地址的不同写法
+		{"10.0.0.1 10.0.0.1/32 10.0.0.0-1", []string{"10.0.0.1", "10.0.0.0"}},
+		{"fd00::1", []string{"fd00::1"}},
+		{"[FD00:0::1]", []string{"fd00::1"}},
+		{"fd00::/126", []string{"fd00::", "fd00::1", "fd00::2", "fd00::3"}},
+		{"WWW.Example.com.", []string{"www.example.com"}},
+	}
+	for _, tt := range tests {
+		got, err := ExpandTargets(tt.spec)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ExpandTargets(%q) = %q, %v，应为 %q", tt.spec, got, err, tt.want)
+		}
+	}
+
+	if hosts, err := ExpandTargets("10.1.2.*"); err != nil || len(hosts) != 256 {
+		t.Errorf("ExpandTargets(10.1.2.*) 得到 %d 个地址, %v", len(hosts), err)
+	}
+	if hosts, err := ExpandTargets("10.1.0.0/16"); err != nil || len(hosts) != MaxExpand {
+		t.Errorf("ExpandTargets(10.1.0.0/16) 得到 %d 个地址, %v", len(hosts), err)
+	}
+}
+
+func TestExpandTargetsErrors(t *testing.T) {
+	tests := []struct {
+		spec string
+		want string
+	}{
+		{"10.0.0.0/8", "过大"},
+		{"10.0.0.0/15", "过大"},
+		{"fd00::/64", "过大"},
+		{"10.*.*.*", "过大"},
+		{"10.0.0.0/33", "无效的网段"},
+		{"10.0.0.256", "无效的八位组"},
+		{"10.0.0.20-10", "起始值大于结束值"},
+		{"10.0.0.1 bad_host!", "无效的目标"},
+	}
+	for _, tt := range tests {
+		got, err := ExpandTargets(tt.spec)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("ExpandTargets(%q) = %q, %v，应返回包含 %q 的错误", tt.spec, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,433 @@
+package nmapscan
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Run 对应 nmap -oX 输出的根节点 <nmaprun>
+type Run struct {
+	Scanner          string   `xml:"scanner,attr"`
+	Args             string   `xml:"args,attr"`
+	Start            int64    `xml:"start,attr"`
+	Version          string   `xml:"version,attr"`
+	XMLOutputVersion string   `xml:"xmloutputversion,attr"`
+	ScanInfo         []Info   `xml:"scaninfo"`
+	Hosts            []Host   `xml:"host"`
+	RunStats         RunStats `xml:"runstats"`
+
+	// Incomplete 为true表示输出被截断(如nmap被中断)，只包含已完成的主机
+	Incomplete bool `xml:"-"`
+	// Phases 分阶段扫描时每个阶段的参数和耗时，不来自XML
+	Phases []Phase `xml:"-"`
+}
+
+// Phase 分阶段扫描中的一个阶段，如端口发现、服务识别
+type Phase struct {
+	Name      string
+	Args      string
+	Elapsed   time.Duration
+	OpenPorts int
+}
+
+// Info 扫描类型信息 <scaninfo>
+type Info struct {
+	Type        string `xml:"type,attr"`
+	Protocol    string `xml:"protocol,attr"`
+	NumServices int    `xml:"numservices,attr"`
+	Services    string `xml:"services,attr"`
+}
+
+type RunStats struct {
+	Finished Finished  `xml:"finished"`
+	Hosts    HostStats `xml:"hosts"`
+}
+
+type Finished struct {
+	Time    int64   `xml:"time,attr"`
+	Elapsed float64 `xml:"elapsed,attr"`
+	Summary string  `xml:"summary,attr"`
+	Exit    string  `xml:"exit,attr"`
+}
+
+type HostStats struct {
+	Up    int `xml:"up,attr"`
+	Down  int `xml:"down,attr"`
+	Total int `xml:"total,attr"`
+}
+
+// Host 单个主机 <host>
+type Host struct {
+	StartTime int64      `xml:"starttime,attr"`
+	EndTime   int64      `xml:"endtime,attr"`
+	Status    Status     `xml:"status"`
+	Addresses []Address  `xml:"address"`
+	Hostnames []Hostname `xml:"hostnames>hostname"`
+	Ports     []Port     `xml:"ports>port"`
+	OS        OS         `xml:"os"`
+	// 主机级别的NSE脚本结果，如 smb-os-discovery
+	HostScripts []Script `xml:"hostscript>script"`
+	// 未列出的端口汇总，如 <extraports state="filtered" count="1000">
+	ExtraPorts []ExtraPorts `xml:"ports>extraports"`
+	Uptime     *Uptime      `xml:"uptime"`
+	Distance   *Distance    `xml:"distance"`
+	Times      *Times       `xml:"times"`
+	Trace      *Trace       `xml:"trace"`
+}
+
+type ExtraPorts struct {
+	State string `xml:"state,attr"`
+	Count int    `xml:"count,attr"`
+}
+
+// Uptime 运行时间推测 <uptime>，需要 -O
+type Uptime struct {
+	Seconds  int64  `xml:"seconds,attr"`
+	LastBoot string `xml:"lastboot,attr"`
+}
+
+// Distance 网络距离(跳数) <distance>
+type Distance struct {
+	Value int `xml:"value,attr"`
+}
+
+// Times 往返时间 <times>，单位为微秒
+type Times struct {
+	SRTT   int64 `xml:"srtt,attr"`
+	RTTVar int64 `xml:"rttvar,attr"`
+	To     int64 `xml:"to,attr"`
+}
+
+// Trace 路由跟踪结果 <trace>，需要 --traceroute
+type Trace struct {
+	Port     int    `xml:"port,attr"`
+	Protocol string `xml:"proto,attr"`
+	Hops     []Hop  `xml:"hop"`
+}
+
+type Hop struct {
+	TTL    int     `xml:"ttl,attr"`
+	IPAddr string  `xml:"ipaddr,attr"`
+	RTT    float64 `xml:"rtt,attr"` // 毫秒
+	Host   string  `xml:"host,attr"`
+}
+
+type Status struct {
+	State  string `xml:"state,attr"`
+	Reason string `xml:"reason,attr"`
+}
+
+type Address struct {
+	Addr     string `xml:"addr,attr"`
+	AddrType string `xml:"addrtype,attr"`
+	Vendor   string `xml:"vendor,attr"`
+}
+
+type Hostname struct {
+	Name string `xml:"name,attr"`
+	Type string `xml:"type,attr"`
+}
+
+// Port 端口 <port>
+type Port struct {
+	Protocol string    `xml:"protocol,attr"`
+	PortID   int       `xml:"portid,attr"`
+	State    PortState `xml:"state"`
+	Service  Service   `xml:"service"`
+	Scripts  []Script  `xml:"script"`
+}
+
+type PortState struct {
+	State  string `xml:"state,attr"`
+	Reason string `xml:"reason,attr"`
+}
+
+// Service 服务识别结果 <service>
+type Service struct {
+	Name      string   `xml:"name,attr"`
+	Product   string   `xml:"product,attr"`
+	Version   string   `xml:"version,attr"`
+	ExtraInfo string   `xml:"extrainfo,attr"`
+	Tunnel    string   `xml:"tunnel,attr"`
+	Method    string   `xml:"method,attr"`
+	Conf      int      `xml:"conf,attr"`
+	CPEs      []string `xml:"cpe"`
+}
+
+// Script NSE脚本结果 <script>，Output 为文本输出，Elems/Tables 为结构化输出
+type Script struct {
+	ID     string  `xml:"id,attr"`
+	Output string  `xml:"output,attr"`
+	Elems  []Elem  `xml:"elem"`
+	Tables []Table `xml:"table"`
+}
+
+type Elem struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+type Table struct {
+	Key    string  `xml:"key,attr"`
+	Elems  []Elem  `xml:"elem"`
+	Tables []Table `xml:"table"`
+}
+
+type OS struct {
+	Matches []OSMatch `xml:"osmatch"`
+}
+
+// OSMatch 操作系统匹配 <osmatch>
+type OSMatch struct {
+	Name     string    `xml:"name,attr"`
+	Accuracy int       `xml:"accuracy,attr"`
+	Classes  []OSClass `xml:"osclass"`
+}
+
+type OSClass struct {
+	Type     string   `xml:"type,attr"`
+	Vendor   string   `xml:"vendor,attr"`
+	OSFamily string   `xml:"osfamily,attr"`
+	OSGen    string   `xml:"osgen,attr"`
+	Accuracy int      `xml:"accuracy,attr"`
+	CPEs     []string `xml:"cpe"`
+}
+
+// Meta 扫描元数据
+type Meta struct {
+	Scanner string
+	Version string
+	Args    string
+	Start   time.Time
+	End     time.Time
+	Elapsed time.Duration
+	Summary string
+	Exit    string
+	Phases  []Phase
+}
+
+// ParseXML 解析 nmap -oX 输出
+func ParseXML(data []byte) (*Run, error) {
+	var run Run
+	if err := xml.Unmarshal(data, &run); err != nil {
+		return nil, fmt.Errorf("解析nmap XML失败: %v", err)
+	}
+	return &run, nil
+}
+
+// ParsePartialXML 解析可能不完整的 nmap -oX 输出。nmap被中断时XML没有闭合，
+// 此时返回已完整输出的主机并将 Incomplete 置为true
+func ParsePartialXML(data []byte) (*Run, error) {
+	var run Run
+	started := false
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if !started {
+				return nil, fmt.Errorf("解析nmap XML失败: %v", err)
+			}
+			run.Incomplete = true
+			return &run, nil
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		var decodeErr error
+		switch start.Name.Local {
+		case "nmaprun":
+			started = true
+			decodeRunAttrs(&run, start)
+		case "scaninfo":
+			var info Info
+			if decodeErr = decoder.DecodeElement(&info, &start); decodeErr == nil {
+				run.ScanInfo = append(run.ScanInfo, info)
+			}
+		case "host":
+			var host Host
+			if decodeErr = decoder.DecodeElement(&host, &start); decodeErr == nil {
+				run.Hosts = append(run.Hosts, host)
+			}
+		case "runstats":
+			decodeErr = decoder.DecodeElement(&run.RunStats, &start)
+		}
+		// 元素不完整说明输出在此处被截断
+		if decodeErr != nil {
+			run.Incomplete = true
+			return &run, nil
+		}
+	}
+	if !started {
+		return nil, fmt.Errorf("解析nmap XML失败: 没有找到nmaprun节点")
+	}
+	// 正常结束的扫描一定有 runstats/finished
+	if run.RunStats.Finished.Time == 0 {
+		run.Incomplete = true
+	}
+	return &run, nil
+}
+
+func decodeRunAttrs(run *Run, start xml.StartElement) {
+	for _, attr := range start.Attr {
+		switch attr.Name.Local {
+		case "scanner":
+			run.Scanner = attr.Value
+		case "args":
+			run.Args = attr.Value
+		case "start":
+			run.Start, _ = strconv.ParseInt(attr.Value, 10, 64)
+		case "version":
+			run.Version = attr.Value
+		case "xmloutputversion":
+			run.XMLOutputVersion = attr.Value
+		}
+	}
+}
+
+// Meta 返回扫描元数据
+func (r *Run) Meta() Meta {
+	meta := Meta{
+		Scanner: r.Scanner,
+		Version: r.Version,
+		Args:    r.Args,
+		Elapsed: time.Duration(r.RunStats.Finished.Elapsed * float64(time.Second)),
+		Summary: r.RunStats.Finished.Summary,
+		Exit:    r.RunStats.Finished.Exit,
+		Phases:  r.Phases,
+	}
+	if r.Start > 0 {
+		meta.Start = time.Unix(r.Start, 0)
+	}
+	if r.RunStats.Finished.Time > 0 {
+		meta.End = time.Unix(r.RunStats.Finished.Time, 0)
+	}
+	return meta
+}
+
+// Addr 返回主机的IP地址，优先IPv4
+func (h *Host) Addr() string {
+	for _, addrType := range []string{"ipv4", "ipv6"} {
+		for _, a := range h.Addresses {
+			if a.AddrType == addrType {
+				return a.Addr
+			}
+		}
+	}
+	return ""
+}
+
+// MAC 返回主机的MAC地址及厂商
+func (h *Host) MAC() (string, string) {
+	for _, a := range h.Addresses {
+		if a.AddrType == "mac" {
+			return a.Addr, a.Vendor
+		}
+	}
+	return "", ""
+}
+
+// PTR 反向DNS解析得到的主机名
+func (h *Host) PTR() string {
+	for _, n := range h.Hostnames {
+		if n.Type == "PTR" {
+			return n.Name
+		}
+	}
+	return ""
+}
+
+// Up 主机是否在线
+func (h *Host) Up() bool {
+	return h.Status.State == "up"
+}
+
+// ID 返回 "22" 形式的端口号
+func (p *Port) ID() string {
+	return strconv.Itoa(p.PortID)
+}
+
+// Detail 拼接 product/version/extrainfo，与 nmap 普通输出的 VERSION 列一致
+func (s *Service) Detail() string {
+	var parts []string
+	for _, v := range []string{s.Product, s.Version} {
+		if v != "" {
+			parts = append(parts, v)
+		}
+	}
+	if s.ExtraInfo != "" {
+		parts = append(parts, "("+s.ExtraInfo+")")
+	}
+	return strings.Join(parts, " ")
+}
+
+// DisplayName 与普通输出的 SERVICE 列一致，ssl 隧道显示为 ssl/http
+func (s *Service) DisplayName() string {
+	name := s.Name
+	if s.Tunnel != "" && name != "" {
+		name = s.Tunnel + "/" + name
+	}
+	return name
+}
+
+// Exact 返回精确匹配的操作系统(accuracy=100)，对应 "OS details"
+func (o *OS) Exact() []OSMatch {
+	var matches []OSMatch
+	for _, m := range o.Matches {
+		if m.Accuracy == 100 {
+			matches = append(matches, m)
+		}
+	}
+	return matches
+}
+
+// Guesses 返回非精确的操作系统猜测，对应 "Aggressive OS guesses"
+func (o *OS) Guesses() []OSMatch {
+	var matches []OSMatch
+	for _, m := range o.Matches {
+		if m.Accuracy < 100 {
+			matches = append(matches, m)
+		}
+	}
+	return matches
+}
+
+// Lookup 按key路径查找结构化输出中的值，如 Lookup("subject", "commonName")，没有时返回空字符串
+func (s *Script) Lookup(path ...string) string {
+	elems, tables := s.Elems, s.Tables
+	for i, key := range path {
+		if i == len(path)-1 {
+			for _, e := range elems {
+				if e.Key == key {
+					return strings.TrimSpace(e.Value)
+				}
+			}
+			return ""
+		}
+		found := false
+		for _, t := range tables {
+			if t.Key == key {
+				elems, tables = t.Elems, t.Tables
+				found = true
+				break
+			}
+		}
+		if !found {
+			return ""
+		}
+	}
+	return ""
+}
+
+func (m OSMatch) String() string {
+	return fmt.Sprintf("%s (%d%%)", m.Name, m.Accuracy)
+}
@@ -0,0 +1,101 @@
+package nmapscan
+
+import (
+	"strings"
+	"testing"
+)
+
+const sampleXML = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE nmaprun>
+<nmaprun scanner="nmap" args="nmap -sV -oX - -iL -" start="1792030323" version="7.94" xmloutputversion="1.05">
+<scaninfo type="syn" protocol="tcp" numservices="1000" services="1-1000"/>
+<host starttime="1792030323" endtime="1792030341"><status state="up" reason="echo-reply"/>
+<address addr="10.0.0.1" addrtype="ipv4"/>
+<ports>
+<port protocol="tcp" portid="443"><state state="open" reason="syn-ack"/><service name="http" product="Microsoft IIS httpd" version="10.0" extrainfo="Windows Server 2016" tunnel="ssl" method="probed" conf="10"/></port>
+<port protocol="tcp" portid="3389"><state state="open" reason="syn-ack"/><service name="tcpwrapped" method="probed" conf="8"/></port>
+</ports>
+</host>
+<host starttime="1792030323" endtime="1792030330"><status state="up" reason="echo-reply"/>
+<address addr="10.0.0.2" addrtype="ipv4"/>
+<ports><extraports state="filtered" count="1000"/></ports>
+</host>
+<runstats><finished time="1792030341" elapsed="18.21" exit="success"/><hosts up="2" down="0" total="2"/></runstats>
+</nmaprun>
+`
+
+func TestParsePartialXML(t *testing.T) {
+	// 第二个主机开始处截断
+	cut := strings.Index(sampleXML, `<host starttime="1792030323" endtime="1792030330">`)
+	tests := []struct {
+		name       string
+		data       string
+		hosts      int
+		incomplete bool
+		err        bool
+	}{
+		{"完整输出", sampleXML, 2, false, false},
+		{"在主机之间截断", sampleXML[:cut], 1, true, false},
+		{"在主机内部截断", sampleXML[:cut+80], 1, true, false},
+		{"只有nmaprun", sampleXML[:strings.Index(sampleXML, "<scaninfo")], 0, true, false},
+		// 闭合但没有 runstats/finished 的输出也不是正常结束的扫描
+		{"没有runstats", sampleXML[:strings.Index(sampleXML, "<runstats>")] + "</nmaprun>", 2, true, false},
+		{"空输出", "", 0, false, true},
+		{"不是XML", "Starting Nmap 7.94\nFailed to resolve", 0, false, true},
+		{"不是nmap输出", "<html><body></body></html>", 0, false, true},
+	}
+	for _, tt := range tests {
+		run, err := ParsePartialXML([]byte(tt.data))
+		if tt.err {
+			if err == nil {
+				t.Errorf("%s: 应返回错误", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(run.Hosts) != tt.hosts || run.Incomplete != tt.incomplete {
+			t.Errorf("%s: %d 个主机 Incomplete=%v，应为 %d 个 %v", tt.name, len(run.Hosts), run.Incomplete, tt.hosts, tt.incomplete)
+		}
+		if run.Args != "nmap -sV -oX - -iL -" || run.Version != "7.94" {
+			t.Errorf("%s: nmaprun属性 args=%q version=%q", tt.name, run.Args, run.Version)
+		}
+	}
+}
+
+func TestParsePartialXMLPorts(t *testing.T) {
+	run, err := ParsePartialXML([]byte(sampleXML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(run.Hosts) != 2 {
+		t.Fatalf("%d 个主机", len(run.Hosts))
+	}
+
+	ports := run.Hosts[0].Ports
+	if len(ports) != 2 {
+		t.Fatalf("10.0.0.1 有 %d 个端口", len(ports))
+	}
+	tests := []struct {
+		port             Port
+		id, name, detail string
+	}{
+		// 多个单词的产品名和版本保持原样
+		{ports[0], "443", "ssl/http", "Microsoft IIS httpd 10.0 (Windows Server 2016)"},
+		// tcpwrapped 没有产品和版本
+		{ports[1], "3389", "tcpwrapped", ""},
+	}
+	for _, tt := range tests {
+		if id, name, detail := tt.port.ID(), tt.port.Service.DisplayName(), tt.port.Service.Detail(); id != tt.id || name != tt.name || detail != tt.detail {
+			t.Errorf("端口 = %s %q %q，应为 %s %q %q", id, name, detail, tt.id, tt.name, tt.detail)
+		}
+	}
+
+	// 没有列出端口的主机只有汇总
+	host := run.Hosts[1]
+	if len(host.Ports) != 0 || len(host.ExtraPorts) != 1 || host.ExtraPorts[0].Count != 1000 || host.ExtraPorts[0].State != "filtered" {
+		t.Errorf("10.0.0.2 端口 %+v 汇总 %+v", host.Ports, host.ExtraPorts)
+	}
+}
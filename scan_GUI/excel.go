@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 
+	nmapscan "github.com/helar52-xl/batch_scan_ip_base_nmap/nmap_scan"
 	"github.com/xuri/excelize/v2"
 )
 
@@ -21,40 +22,60 @@ type Record struct {
     OSGuess      string
 }
 
-func readExcelFile(filePath string) ([]Record, error) {
+// 结果表格中除标准列以外的列
+var recordColumns = []nmapscan.Column{
+    {Key: "protocol", Aliases: []string{"协议", "protocol"}},
+    {Key: "service", Aliases: []string{"服务", "service"}},
+    {Key: "version", Aliases: []string{"版本", "应用", "version"}},
+    {Key: "status", Aliases: []string{"状态", "status", "state"}},
+    {Key: "os", Aliases: []string{"操作系统", "os"}},
+    {Key: "os_guess", Aliases: []string{"操作系统猜测", "os guess"}},
+}
+
+// 读取Excel，按表头文字定位各列，sheet 为工作表名称或序号，为空时使用 Sheet1 或第一个工作表
+func readExcelFile(filePath string, sheet string) ([]Record, error) {
     f, err := excelize.OpenFile(filePath)
     if err != nil {
         return nil, err
     }
     defer f.Close()
     
-    rows, err := f.GetRows("Sheet1")
+    sheet, err = nmapscan.SelectSheet(f.GetSheetList(), sheet)
+    if err != nil {
+        return nil, err
+    }
+    rows, err := f.GetRows(sheet)
+    if err != nil {
+        return nil, err
+    }
+    if len(rows) == 0 {
+        return nil, fmt.Errorf("工作表 %s 为空", sheet)
+    }
+    
+    cols, err := nmapscan.MapColumns(rows[0], append(nmapscan.InputColumns(nmapscan.ColIP), recordColumns...))
     if err != nil {
         return nil, err
     }
     
     var records []Record
-    for i, row := range rows {
-        if i == 0 {
-            continue // 跳过标题行
+    for _, row := range rows[1:] {
+        record := Record{
+            Organization: cols.Value(row, nmapscan.ColNumber),
+            WebsiteName:  cols.Value(row, nmapscan.ColName),
+            WebsiteAddr:  cols.Value(row, nmapscan.ColDomain),
+            IP:           cols.Value(row, nmapscan.ColIP),
+            Port:         cols.Value(row, nmapscan.ColPort),
+            Protocol:     cols.Value(row, "protocol"),
+            Service:      cols.Value(row, "service"),
+            Version:      cols.Value(row, "version"),
+            Status:       cols.Value(row, "status"),
+            OS:           cols.Value(row, "os"),
+            Notes:        cols.Value(row, nmapscan.ColRemark),
+            OSGuess:      cols.Value(row, "os_guess"),
         }
-        if len(row) < 12 {
+        if record.IP == "" {
             continue
         }
-        record := Record{
-            Organization: row[0],
-            WebsiteName:  row[1],
-            WebsiteAddr:  row[2],
-            IP:          row[3],
-            Port:        row[4],
-            Protocol:    row[5],
-            Service:     row[6],
-            Version:     row[7],
-            Status:      row[8],
-            OS:          row[9],
-            Notes:       row[10],
-            OSGuess:     row[11],
-        }
         records = append(records, record)
     }
     
@@ -1,12 +1,16 @@
 package main
 
 import (
+	"strings"
+
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/app"
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/dialog"
 	"fyne.io/fyne/v2/layout"
 	"fyne.io/fyne/v2/widget"
+
+	nmapscan "github.com/helar52-xl/batch_scan_ip_base_nmap/nmap_scan"
 )
 
 func main() {
@@ -20,6 +24,11 @@ func main() {
     outputNameEntry.SetPlaceHolder("输出文件名称")
     nmapCmdEntry := widget.NewEntry()
     nmapCmdEntry.SetText("-sV -O")
+    // 输入时检查nmap参数，不允许输出选项和扫描目标
+    nmapCmdEntry.Validator = func(text string) error {
+        _, _, err := nmapscan.ParseArgs(text)
+        return err
+    }
     
     // 使用固定宽度的容器来控制输入框宽度
     outputContainer := container.NewHBox(
@@ -46,7 +55,18 @@ func main() {
     
     // 创建扫描状态显示
     progressBar := widget.NewProgressBar()
-    statusLabel := widget.NewLabel("就绪")
+    statusLabel := widget.NewLabel(readyText)
+    nmapCmdEntry.OnChanged = func(text string) {
+        _, warnings, err := nmapscan.ParseArgs(text)
+        switch {
+        case err != nil:
+            statusLabel.SetText(err.Error())
+        case len(warnings) > 0:
+            statusLabel.SetText("警告: " + strings.Join(warnings, "; "))
+        default:
+            statusLabel.SetText(readyText)
+        }
+    }
     
     // 开始扫描按钮
     startBtn := widget.NewButton("开始扫描", nil)
@@ -1,10 +1,11 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"os/exec"
-	"strings"
 	"time"
+
+	nmapscan "github.com/helar52-xl/batch_scan_ip_base_nmap/nmap_scan"
 )
 
 type ScanResult struct {
@@ -16,13 +17,25 @@ type ScanResult struct {
     OSGuess       string
 }
 
+// 扫描使用的Scanner，本机没有nmap时使用内置的TCP connect扫描，离线测试时可替换为 nmapscan.ReplayScanner
+var scanner, readyText = newScanner()
+
+func newScanner() (nmapscan.Scanner, string) {
+    if nmapscan.NmapAvailable("") {
+        return &nmapscan.ExecScanner{}, "就绪"
+    }
+    return &nmapscan.ConnectScanner{Retries: 1}, "就绪(未找到nmap，使用内置的TCP connect扫描，只能得到端口状态)"
+}
+
 func performNmapScan(ip string, nmapCmd string) (*ScanResult, error) {
-    args := strings.Split(nmapCmd, " ")
-    args = append(args, ip)
+    args, _, err := nmapscan.ParseArgs(nmapCmd)
+    if err != nil {
+        return nil, err
+    }
+    opts := nmapscan.Options{Args: args}
     
     start := time.Now()
-    cmd := exec.Command("nmap", args...)
-    output, err := cmd.CombinedOutput()
+    run, err := scanner.Scan(context.Background(), ip, opts)
     if err != nil {
         return nil, err
     }
@@ -33,21 +46,20 @@ func performNmapScan(ip string, nmapCmd string) (*ScanResult, error) {
         IP: fmt.Sprintf("%s (扫描用时: %v)", ip, duration),
     }
     
-    // 解析nmap输出
-    lines := strings.Split(string(output), "\n")
-    for _, line := range lines {
-        if strings.Contains(line, "open") {
-            parts := strings.Fields(line)
-            if len(parts) >= 3 {
-                result.Ports = append(result.Ports, parts[0])
-                result.Services = append(result.Services, parts[2])
-                if len(parts) > 3 {
-                    result.Versions = append(result.Versions, strings.Join(parts[3:], " "))
-                }
+    for _, host := range run.Hosts {
+        for _, port := range host.Ports {
+            if port.State.State != "open" {
+                continue
             }
+            result.Ports = append(result.Ports, port.ID()+"/"+port.Protocol)
+            result.Services = append(result.Services, port.Service.DisplayName())
+            result.Versions = append(result.Versions, port.Service.Detail())
+        }
+        if exact := host.OS.Exact(); len(exact) > 0 {
+            result.OS = exact[0].Name
         }
-        if strings.Contains(line, "OS details:") {
-            result.OS = strings.TrimPrefix(line, "OS details: ")
+        if guesses := host.OS.Guesses(); len(guesses) > 0 {
+            result.OSGuess = guesses[0].String()
         }
     }
     